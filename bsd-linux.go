@@ -12,6 +12,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash/fnv"
 	"io"
 	"math"
 	"os"
@@ -37,20 +38,23 @@ var (
 
 func setupSoundCard(file string) (sc soundcard, success bool) {
 	// open audio output (everything is a file...)
-	var rr error
-	sc.file, rr = os.OpenFile(file, os.O_WRONLY, 0644)
+	mode := os.O_WRONLY
+	if duplex {
+		mode = os.O_RDWR // full duplex, input is read by soundcardRead
+	}
+	f, rr := os.OpenFile(file, mode, 0644)
 	if e(rr) {
-		p(rr)
-		p("soundcard not available, shutting down...")
+		p(rr) // explained by noSoundcard
 		return sc, not
 	}
+	sc.file = f
 
 	// set bit format
 	var req uint32 = SNDCTL_DSP_SETFMT
 	var data uint32 = SELECTED_FMT
 	_, _, ern := syscall.Syscall(
 		syscall.SYS_IOCTL,
-		uintptr(sc.file.Fd()),
+		uintptr(f.Fd()),
 		uintptr(req),
 		uintptr(unsafe.Pointer(&data)),
 	)
@@ -76,16 +80,23 @@ func setupSoundCard(file string) (sc soundcard, success bool) {
 		return sc, not
 	}
 
-	// set channels here, stereo or mono
+	// set channels here, stereo, mono or quad
 	req = SNDCTL_DSP_CHANNELS
 	data = CHANNELS
+	if mono {
+		data = MONO
+	}
+	if quad {
+		req, data = SNDCTL_DSP_SETCHANNELS, QUAD
+	}
+	requested := data
 	_, _, ern = syscall.Syscall(
 		syscall.SYS_IOCTL,
-		uintptr(sc.file.Fd()),
+		uintptr(f.Fd()),
 		uintptr(req),
 		uintptr(unsafe.Pointer(&data)),
 	)
-	if ern != 0 || data != CHANNELS {
+	if ern != 0 || data != requested {
 		p("\n--requested channels not accepted--")
 		return sc, not
 	}
@@ -94,6 +105,8 @@ func setupSoundCard(file string) (sc soundcard, success bool) {
 		sc.channels = "stereo"
 	case MONO:
 		sc.channels = "mono"
+	case QUAD:
+		sc.channels = "quad"
 	default:
 		p("\n--Incompatible channels! Change requested format in file--\n")
 		return sc, not
@@ -105,7 +118,7 @@ func setupSoundCard(file string) (sc soundcard, success bool) {
 	data = sr
 	_, _, ern = syscall.Syscall(
 		syscall.SYS_IOCTL,
-		uintptr(sc.file.Fd()),
+		uintptr(f.Fd()),
 		uintptr(req),
 		uintptr(unsafe.Pointer(&data)),
 	)
@@ -121,38 +134,118 @@ func setupSoundCard(file string) (sc soundcard, success bool) {
 	display.SR = sc.sampleRate
 	display.Format = sc.format
 	display.Channel = sc.channels
+	display.Backend = "OSS"
+	display.Device = file
 	return sc, yes
 }
 
-func checkFlag(sr uint32) uint32 {
-	if len(os.Args) < 3 {
-		return sr
+const defaultDevice = "/dev/dsp"
+
+// ossDevice finds a soundcard by index, eg. 1 for /dev/dsp1, by name or by path,
+// falling back to the default if not found
+func ossDevice(a string) string {
+	d := a
+	if n, rr := strconv.Atoi(a); !e(rr) {
+		d = sf("%s%d", defaultDevice, n)
+	} else if !strings.HasPrefix(a, "/") {
+		d = "/dev/" + a
+	}
+	if _, rr := os.Stat(d); e(rr) {
+		pf("%s not found, using %s\n", d, defaultDevice)
+		return defaultDevice
+	}
+	return d
+}
+
+func listDevices() {
+	ds, _ := filepath.Glob(defaultDevice + "*")
+	if len(ds) == 0 {
+		p("no soundcards found")
 	}
-	switch os.Args[1] {
-	case "--sr", "--SR", "-s":
-		// break
-	default:
-		return sr
+	for _, d := range ds {
+		p(d)
 	}
-	if os.Args[2] == "44.1" { // for convenience
-		os.Args[2] = "44"
+	if s, rr := os.ReadFile("/dev/sndstat"); !e(rr) { // descriptions, on FreeBSD
+		pf("\n%s", s)
 	}
-	flag, err := strconv.Atoi(os.Args[2])
-	if err != nil {
-		return sr
+}
+
+// noSoundcard explains how sound output may be found, OSS being the only backend
+func noSoundcard(device string) {
+	pf("\n%sno sound output:%s OSS device %s could not be set up\n", italic, reset, device)
+	p("  --list-devices lists the devices found, choose one with --device")
+	switch runtime.GOOS {
+	case "linux":
+		p("  Linux provides OSS by emulation, load it with `sudo modprobe snd-pcm-oss`, or run Syntə under `padsp` or `osspd`")
+	case "freebsd":
+		p("  load a sound driver with `sudo kldload snd_driver`, then see `cat /dev/sndstat`")
 	}
-	switch flag {
-	case 48:
-		flag = 48000
-	case 44:
-		flag = 44100
-	case 96:
-		flag = 96000
+	p("  --null runs Syntə without sound output")
+}
+
+const reconnectInterval = time.Second // between attempts to reopen a lost soundcard
+
+// reconnector writes to the soundcard and, if a write fails, reopens the device so a
+// disconnected interface doesn't end the session. Output is discarded at the sample rate until then
+type reconnector struct {
+	sc      soundcard
+	device  string
+	lost    bool
+	attempt time.Time
+}
+
+func (r *reconnector) Write(b []byte) (int, error) {
+	if !r.lost {
+		n, rr := r.sc.file.Write(b)
+		if !e(rr) {
+			return n, nil
+		}
+		msg("%ssoundcard lost:%s %v", italic, reset, rr)
+		r.sc.file.Close()
+		r.lost = yes
+		display.Device = "reconnecting..."
+	}
+	if time.Since(r.attempt) > reconnectInterval {
+		r.attempt = time.Now()
+		if _, rr := os.Stat(r.device); !e(rr) {
+			sc, ok := setupSoundCard(r.device)
+			switch {
+			case ok && sc.format == r.sc.format && sc.sampleRate == r.sc.sampleRate:
+				r.sc.file = sc.file
+				r.lost = not
+				msg("%ssoundcard reconnected%s", italic, reset)
+				r.sc.file.Write(b) // an error here will be caught on the next write
+				return len(b), nil
+			case ok: // sound engine can't change format or sample rate while running
+				sc.file.Close()
+				display.Device = "reconnecting..."
+			}
+		}
+	}
+	ch := 2
+	switch r.sc.channels {
+	case "mono":
+		ch = 1
+	case "quad":
+		ch = 4
 	}
-	if flag < 12000 || flag > 192000 {
-		return sr
+	frames := len(b) / (r.sc.format / 8) / ch
+	time.Sleep(time.Duration(float64(frames) / r.sc.sampleRate * 1e9))
+	return len(b), nil
+}
+
+func (r *reconnector) Read(b []byte) (int, error) {
+	if rd, ok := r.sc.file.(io.Reader); ok && !r.lost {
+		return rd.Read(b)
 	}
-    return uint32(flag)
+	return 0, io.ErrClosedPipe
+}
+
+func (r *reconnector) Close() error {
+	if r.lost {
+		return nil
+	}
+	return r.sc.file.Close()
 }
 
 func recordWav(s systemState) (systemState, int) {
@@ -198,14 +291,97 @@ func closeWavFile() {
 	wavFile.Close()
 }
 
+// saveVersion is recorded in functions.json and listing recordings.
+// Increment if the saved format of fn or operation changes, adding a migration in upgrade()
+const saveVersion = 1
+
+// recording is the format of listings saved in 'recordings/'
+type recording struct {
+	Version int
+	Listing listing
+}
+
 // loads Syntə functions from file in project root called 'functions.json'
 func loadFunctions(data *map[string]fn) {
 	f := "functions.json"
 	j, rr := os.ReadFile(f)
-	rr2 := json.Unmarshal(j, data)
-	if e(rr) || e(rr2) {
-		pf("Error loading '%s': %v %v\n", f, rr, rr2)
+	if e(rr) {
+		pf("Error loading '%s': %v\n", f, rr)
+		return
+	}
+	var raw map[string]json.RawMessage
+	if rr := json.Unmarshal(j, &raw); e(rr) {
+		pf("Error loading '%s': %v\n", f, rr)
+		raw = recoverFunctions(j)
+		// kept, as the functions recovered will be saved over the original
+		b := sf("%s.%s.corrupt", f, time.Now().Format("02-01-06.15:04"))
+		if rr := os.WriteFile(b, j, 0666); e(rr) {
+			pf("%sunable to back up '%s': %v%s\n", italic, f, rr, reset)
+		} else {
+			pf("%s'%s' is corrupt, backed up to '%s'%s\n", italic, f, b, reset)
+		}
+		defer func() { pf("%s%d functions recovered%s\n", italic, len(*data), reset) }()
+	}
+	v := 0
+	if rr := json.Unmarshal(raw["Version"], &v); e(rr) {
+		v = 0 // absent or malformed
+	}
+	delete(raw, "Version")
+	if w := upgrade(f, v); w != "" {
+		pf("%s\n", w)
 	}
+	for name, r := range raw {
+		var function fn
+		if rr := json.Unmarshal(r, &function); e(rr) {
+			pf("Error loading function '%s': %v\n", name, rr)
+			continue
+		}
+		(*data)[name] = function
+	}
+}
+
+// recoverFunctions reads entries of a malformed functions file up to the first error
+func recoverFunctions(j []byte) map[string]json.RawMessage {
+	raw := map[string]json.RawMessage{}
+	dec := json.NewDecoder(bytes.NewReader(j))
+	if t, rr := dec.Token(); e(rr) || t != json.Delim('{') {
+		return raw
+	}
+	for dec.More() {
+		t, rr := dec.Token()
+		name, ok := t.(string)
+		if e(rr) || !ok {
+			break
+		}
+		var r json.RawMessage
+		if rr := dec.Decode(&r); e(rr) {
+			break
+		}
+		raw[name] = r
+	}
+	return raw
+}
+
+// saveFunctions records the version alongside the functions
+func saveFunctions(funcs map[string]fn) bool {
+	data := make(map[string]interface{}, len(funcs)+1)
+	for name, function := range funcs {
+		data[name] = function
+	}
+	data["Version"] = saveVersion
+	return saveJson(data, "functions.json")
+}
+
+// upgrade reports on files saved with a different version, there are no migrations needed as yet
+func upgrade(f string, v int) string {
+	switch {
+	case v == 0:
+		return sf("%s'%s' has no version, assumed to be version %d%s", italic, f, saveVersion, reset)
+	case v > saveVersion:
+		return sf("%s'%s' is from a newer version of Syntə (%d > %d), may not load correctly%s",
+			italic, f, v, saveVersion, reset)
+	}
+	return ""
 }
 
 // used for saving info, listings, functions and code recordings (not audio)
@@ -220,8 +396,26 @@ func saveJson(data interface{}, f string) bool {
 	return save(j, f)
 }
 
+// save writes to a temporary file alongside, on the same filesystem, which is then renamed
+// into place so that the tools never read a partial file
 func save(data []byte, file string) bool {
-	if rr := os.WriteFile(file, data, 0644); e(rr) {
+	f, rr := os.CreateTemp(filepath.Dir(file), "."+filepath.Base(file)+".*.tmp")
+	if e(rr) {
+		msg("Error saving '%s': %v", file, rr)
+		return false
+	}
+	_, rr = f.Write(data)
+	if rc := f.Close(); rr == nil {
+		rr = rc
+	}
+	if rr == nil {
+		rr = os.Chmod(f.Name(), 0644) // as created 0600
+	}
+	if rr == nil {
+		rr = os.Rename(f.Name(), file)
+	}
+	if e(rr) {
+		os.Remove(f.Name())
 		msg("Error saving '%s': %v", file, rr)
 		return false
 	}
@@ -239,7 +433,7 @@ func decodeWavs() wavs {
 		Name string
 		Data []float64
 	}
-	files, rr := os.ReadDir("./wavs")
+	files, rr := os.ReadDir(wavDir)
 	if e(rr) {
 		pf("%sno wavs:%s %v\n", italic, reset, rr)
 		return nil
@@ -262,7 +456,7 @@ func decodeWavs() wavs {
 	}
 	pf("%sProcessing wavs...%s\n", italic, reset)
 	for _, file := range filelist {
-		r, rr := os.Open("./wavs/" + file)
+		r, rr := os.Open(filepath.Join(wavDir, file))
 		if e(rr) {
 			msg("error loading: %s %s", file, rr)
 			continue
@@ -270,13 +464,17 @@ func decodeWavs() wavs {
 		length := WAV_TIME * 192000
 		data := make([]byte, 44+8*length) // enough for 32bit stereo WAV_TIME @ 192kHz
 		n, err := io.ReadFull(r, data)
+		r.Close()
 		if errors.Is(err, io.ErrUnexpectedEOF) {
 			data = data[:n] // truncate silent data
-		} else if e(rr) {
-			msg("error reading: %s %s", file, rr)
+		} else if e(err) {
+			msg("error reading: %s %s", file, err)
+			continue
+		}
+		if len(data) <= 44 {
+			msg("no samples, skipped: %s", file)
 			continue
 		}
-		r.Close()
 		// check format=1, channels <3, rate, bits=16or32, skip otherwise
 		format := binary.LittleEndian.Uint16(data[20:22])
 		if format != 1 {
@@ -284,7 +482,7 @@ func decodeWavs() wavs {
 			continue
 		}
 		channels := int(binary.LittleEndian.Uint16(data[22:24]))
-		if channels > 2 {
+		if channels < 1 || channels > 2 {
 			msg("neither mono nor stereo: %s %s", file, rr)
 			continue
 		}
@@ -295,9 +493,13 @@ func decodeWavs() wavs {
 		}
 		length = WAV_TIME * int(sr)
 		bits := binary.LittleEndian.Uint16(data[34:36])
+		if bits != 16 && bits != 24 && bits != 32 {
+			msg("%s: needs to be 32, 24 or 16 bit", file)
+			continue
+		}
 		to := channels * length
-		if len(data) < to {
-			to = len(data[44:]) / channels
+		if n := len(data[44:]) / int(bits/8); n < to {
+			to = n - n%channels // whole samples of all channels
 		}
 		rb := bytes.NewReader(data[44:])
 		switch bits {
@@ -313,14 +515,14 @@ func decodeWavs() wavs {
 			wav.Data = decodeInt32(rb, file, make([]int32, to), float64(math.MaxInt32), to, channels)
 		case 32:
 			wav.Data = decodeInt32(rb, file, make([]int32, to), float64(math.MaxInt32), to, channels)
-		default:
-			msg("%s: needs to be 32, 24 or 16 bit", file)
+		}
+		if len(wav.Data) == 0 { // truncated within the first sample
+			msg("no samples, skipped: %s", file)
 			continue
 		}
 		l := len(file)
 		wav.Name = strings.ReplaceAll(file[:l-4], " ", "")
 		w = append(w, wav)
-		r.Close()
 		t := float64(len(wav.Data)) / float64(sr)
 		c := "stereo"
 		if channels == 1 {
@@ -374,6 +576,51 @@ func decodeInt32(rb *bytes.Reader, file string, samples []int32, factor float64,
 	return wav
 }
 
+// soundcardRead decodes soundcard input to inputSamples, format and channels are those set for output
+func soundcardRead(sc soundcard) {
+	r, ok := sc.file.(io.Reader)
+	if !ok {
+		msg("soundcard input unavailable")
+		return
+	}
+	b := bufio.NewReader(r)
+	bytes := make([]byte, sc.format/8) // shadows package name
+	sample := func() (float64, error) {
+		if _, rr := io.ReadFull(b, bytes); e(rr) {
+			return 0, rr
+		}
+		switch sc.format {
+		case 8:
+			return float64(int8(bytes[0])) / sc.convFactor, nil
+		case 32:
+			return float64(int32(BYTE_ORDER.Uint32(bytes))) / sc.convFactor, nil
+		}
+		return float64(int16(BYTE_ORDER.Uint16(bytes))) / sc.convFactor, nil
+	}
+	for !exit {
+		var s stereoPair
+		var rr error
+		s.left, rr = sample()
+		s.right = s.left
+		if rr == nil && sc.channels != "mono" {
+			s.right, rr = sample()
+		}
+		if rr == nil && sc.channels == "quad" { // rear inputs unused
+			if _, rr = sample(); rr == nil {
+				_, rr = sample()
+			}
+		}
+		if e(rr) {
+			msg("soundcard input: %v", rr)
+			return
+		}
+		select {
+		case inputSamples <- s:
+		default: // sound engine not keeping up, drop sample
+		}
+	}
+}
+
 // quick and basic decode of mouse bytes
 func mouseRead() {
 	var file string
@@ -426,11 +673,11 @@ func mouseRead() {
 			return
 		}
 		if mouse.mc {
-			mouse.X = math.Pow(10, mx/10)
-			mouse.Y = math.Pow(10, my/10)
+			mouse.X = math.Pow(mouse.base, mx*mouse.gain/10)
+			mouse.Y = math.Pow(mouse.base, my*mouse.gain/10)
 		} else {
-			mouse.X = mx / 5
-			mouse.Y = my / 5
+			mouse.X = mx * mouse.gain / 5
+			mouse.Y = my * mouse.gain / 5
 		}
 		display.MouseX = mouse.X
 		display.MouseY = mouse.Y
@@ -438,12 +685,92 @@ func mouseRead() {
 	}
 }
 
+// evdev, from linux/input.h and input-event-codes.h, the codes are the same on FreeBSD
+const (
+	evAbs       = 3
+	absPressure = 0x18
+	absTiltX    = 0x1a
+	absTiltY    = 0x1b
+	eviocgabs   = 24<<16 | 'E'<<8 | 0x40 // _IOR('E', 0x40 + axis, struct input_absinfo), without direction
+)
+
+// evdevRead is the direction bit of _IOR, which differs between Linux and FreeBSD
+func evdevRead() uint32 {
+	if runtime.GOOS == "freebsd" {
+		return 0x40000000 // IOC_OUT
+	}
+	return 0x80000000
+}
+
+// tabletRead sets pressure and tilt of a graphics tablet, scaled by the range of each axis
+func tabletRead(device string) {
+	f, rr := os.Open(device)
+	if e(rr) {
+		msg("tablet unavailable: %v", rr)
+		return
+	}
+	defer f.Close()
+	type axis struct{ min, max float64 }
+	axes := map[uint16]axis{}
+	for _, a := range []uint16{absPressure, absTiltX, absTiltY} {
+		var info [6]int32 // value, minimum, maximum, fuzz, flat, resolution
+		_, _, ern := syscall.Syscall(
+			syscall.SYS_IOCTL,
+			uintptr(f.Fd()),
+			uintptr(evdevRead()|eviocgabs+uint32(a)),
+			uintptr(unsafe.Pointer(&info)),
+		)
+		if ern != 0 || info[2] <= info[1] { // axis not present
+			continue
+		}
+		axes[a] = axis{float64(info[1]), float64(info[2])}
+	}
+	if _, ok := axes[absPressure]; !ok {
+		msg("%s %sis not a tablet, no pressure%s", device, italic, reset)
+		return
+	}
+	tv := int(unsafe.Sizeof(syscall.Timeval{})) // size of the platform's timeval
+	ev := make([]byte, tv+8)                   // struct input_event: timeval, type, code, value
+	for {
+		if _, rr := io.ReadFull(f, ev); e(rr) {
+			msg("error reading tablet: %v", rr)
+			return
+		}
+		code := binary.LittleEndian.Uint16(ev[tv+2:])
+		a, ok := axes[code]
+		if binary.LittleEndian.Uint16(ev[tv:]) != evAbs || !ok {
+			continue
+		}
+		v := (float64(int32(binary.LittleEndian.Uint32(ev[tv+4:]))) - a.min) / (a.max - a.min)
+		switch code {
+		case absPressure:
+			tablet.Pressure = v
+		case absTiltX:
+			tablet.TiltX = 2*v - 1
+		case absTiltY:
+			tablet.TiltY = 2*v - 1
+		}
+	}
+}
+
 // scan stdin from goroutine to allow external concurrent input
 func readInput(from io.Reader) {
 	s := bufio.NewScanner(from)
 	s.Split(bufio.ScanWords)
 	for !exit {
-		s.Scan() // blocks on stdin
+		if !s.Scan() && s.Err() != nil { // blocks on stdin
+			msg("%sinput:%s %v", italic, reset, s.Err()) // eg. an oversized paste
+			s = bufio.NewScanner(from)
+			s.Split(bufio.ScanWords)
+			continue
+		}
+		if s.Text() == "_" { // interrupt a wait in progress
+			select {
+			case cancelWait <- struct{}{}:
+				continue
+			default:
+			}
+		}
 		tokens <- token{s.Text(), -1, not}
 	}
 }
@@ -477,31 +804,60 @@ func reloadListing() {
 		pf("\n%s/ made\n", tempDir)
 	}
 	l := 0
-	stat := make([]time.Time, 0)
+	stat := make([]watched, 0)
 	for {
 		time.Sleep(32361 * time.Microsecond) // coarse loop timing
 		lockLoad <- struct{}{}
+		if l > len(mutes) { // listings compacted, so initialise again
+			l, stat = 0, stat[:0]
+		}
 		for ; l < len(mutes); l++ { // only loops over additional listings, likely just one
-			stat = append(stat, time.Time{})
+			stat = append(stat, watched{})
 		}
 		for i := 0; i < l; i++ {
 			f := sf("%s/%d.syt", tempDir, i)
 			st, rm := os.Stat(f)
-			if e(rm) || st.ModTime().Equal(stat[i]) {
+			if e(rm) || st.ModTime().Equal(stat[i].mod) {
+				continue
+			}
+			if !tokenSpace(2) { // input is backed up, try again on a later loop
+				continue
+			}
+			if time.Since(st.ModTime()) < reloadSettle { // editor may still be writing, check on a later loop
 				continue
 			}
-			if stat[i].IsZero() { // initialise new listings for next loop
-				stat[i] = st.ModTime()
+			b, rr := os.ReadFile(f)
+			if e(rr) {
+				continue
+			}
+			h := fnv.New64a()
+			h.Write(b)
+			sum := h.Sum64()
+			if stat[i].mod.IsZero() { // initialise new listings for next loop
+				stat[i] = watched{st.ModTime(), sum}
+				continue
+			}
+			changed := sum != stat[i].sum
+			stat[i] = watched{st.ModTime(), sum}
+			if !changed { // touched but not edited
 				continue
 			}
 			tokens <- token{"rld", i, yes}
 			tokens <- token{sf("%d", i), i, yes}
-			stat[i] = st.ModTime()
 		}
 		<-lockLoad
 	}
 }
 
+// reloadSettle is the time a file must be unmodified before it is reloaded, so each save reloads once
+const reloadSettle = 100 * time.Millisecond
+
+// modified time and content hash of a '.temp/*.syt' file
+type watched struct {
+	mod time.Time
+	sum uint64
+}
+
 func reloadExcept(current, i int) error {
 	f, rr := os.Open(sf(".temp/%d.syt", i))
 	if e(rr) {
@@ -516,32 +872,130 @@ func reloadExcept(current, i int) error {
 		return nil
 	}
 	infoIfLogging("restart: %d", i)
-	for s.Scan() { // tokens could block here, theoretically
-		tokens <- token{s.Text(), -1, yes}
+	var ws []string
+	for s.Scan() {
+		ws = append(ws, s.Text())
+	}
+	if !tokenSpace(len(ws)) { // tokens are read after the watchdog finishes, so would block
+		return fmt.Errorf("listing %d too long to restart", i)
+	}
+	for _, w := range ws {
+		tokens <- token{w, -1, yes}
 	}
 	return nil
 }
 
-// rootsync can be used to synchronise two instances of Syntə, may be deprecated in future
-func rootSync() bool {
-	f := "../infodisplay.json"
-	d := disp{}
-	s := not
-	info <- "> waiting to sync"
-	for {
-		j, rr := os.ReadFile(f)
-		if e(rr) {
-			info <- sf("error reading: %v", rr)
-			rs = not
-			return false
+const prefsFile = "prefs.json"
+
+// prefs are kept between sessions, saved when set by a mode command
+type prefs struct {
+	MouseGain   float64
+	MouseBase   float64
+	MouseCurve  bool    // exponential
+	LimitAttack float64 // seconds, 0 for instant
+	StereoWidth float64
+}
+
+func currentPrefs() prefs {
+	pr := prefs{MouseGain: mouse.gain, MouseBase: mouse.base, MouseCurve: mouse.mc, StereoWidth: stereoWidth}
+	if limAttack < 1 {
+		pr.LimitAttack = 1 / (limAttack * SampleRate)
+	}
+	return pr
+}
+
+func validMouse(mode string, v float64) bool {
+	switch mode {
+	case "mousegain":
+		return v >= 0.01 && v <= 100
+	case "mousebase":
+		return v > 1 && v <= 1000
+	}
+	return not
+}
+
+func loadPrefs() {
+	j, rr := os.ReadFile(prefsFile)
+	if e(rr) { // none saved yet
+		return
+	}
+	pr := currentPrefs()
+	if rr := json.Unmarshal(j, &pr); e(rr) {
+		msg("%s: %v", prefsFile, rr)
+		return
+	}
+	if validMouse("mousegain", pr.MouseGain) {
+		mouse.gain = pr.MouseGain
+	}
+	if validMouse("mousebase", pr.MouseBase) {
+		mouse.base = pr.MouseBase
+	}
+	mouse.mc = pr.MouseCurve
+	if pr.LimitAttack > 0 {
+		limAttack = math.Min(1, 1/(pr.LimitAttack*SampleRate))
+	}
+	if pr.StereoWidth >= 0 && pr.StereoWidth <= maxWidth {
+		stereoWidth = pr.StereoWidth
+	}
+}
+
+func savePrefs() {
+	saveJson(currentPrefs(), prefsFile)
+}
+
+const controlFile = "control.json" // written by tools/info.go
+
+type remoteControl struct {
+	Pitch, Tempo *float64 // nil if not set
+}
+
+// readControl polls controlFile and sends pitch or tempo to the sound engine. The file is
+// removed once read, so each value is applied once. Listings writing to pitch or tempo
+// will override these values
+func readControl() {
+	for !exit {
+		time.Sleep(100 * time.Millisecond)
+		b, rr := os.ReadFile(controlFile)
+		if e(rr) { // usually not present
+			continue
 		}
-		json.Unmarshal(j, &d) // too many spurious errors
-		if d.Sync && !s {
-			break
+		os.Remove(controlFile)
+		var c remoteControl
+		if rr := json.Unmarshal(b, &c); e(rr) {
+			msg("%scontrol file ignored:%s %v", italic, reset, rr)
+			continue
+		}
+		if !validControl(c.Pitch) || !validControl(c.Tempo) {
+			msg("%scontrol values must be positive numbers, ignored%s", italic, reset)
+			continue
+		}
+		select {
+		case remote <- c:
+		default: // previous not yet applied
+			msg("%scontrol too soon, ignored%s", italic, reset)
 		}
-		s = d.Sync
 	}
+}
+
+func validControl(v *float64) bool {
+	return v == nil || (*v > 0 && !math.IsInf(*v, 0) && !math.IsNaN(*v))
+}
+
+const rootTimeout = 2 * time.Second // longest wait for a sync pulse from root
+
+// rootSync blocks until the next sync pulse from the root instance, see syncFollow
+func rootSync() bool {
 	rs = not
+	for len(rootPulse) > 0 { // discard stale pulse
+		<-rootPulse
+	}
+	info <- "> waiting to sync"
+	select {
+	case <-rootPulse:
+	case <-time.After(rootTimeout):
+		info <- "root unavailable, not synced"
+		return false
+	}
 	if len(info) < infoBuffer {
 		info <- "< synced to root"
 	}
@@ -577,19 +1031,29 @@ func selectOutput(bits int) func(w io.Writer, f float64) {
 	return output
 }
 
+// lsExtensions are the files listed by `ls` for folders not holding .syt listings
+var lsExtensions = map[string]string{
+	"wavs":             ".wav",
+	"audio-recordings": ".wav",
+	"recordings":       ".json",
+}
+
 func ls(s systemState) (systemState, int) {
 	if s.operand == "l" {
 		s.operand += "istings"
 	}
 	dir := "./" + s.operand
+	if filepath.Clean(s.operand) == "wavs" {
+		dir = wavDir // may be elsewhere, see --wavs
+	}
 	files, rr := os.ReadDir(dir)
 	if e(rr) {
 		msg("unable to access '%s': %s", dir, rr)
 		return s, startNewOperation
 	}
-	extn := ".syt"
-	if dir == "./wavs" {
-		extn = ".wav"
+	extn, in := lsExtensions[filepath.Clean(s.operand)]
+	if !in {
+		extn = ".syt"
 	}
 	ls := ""
 	for _, file := range files {
@@ -597,7 +1061,7 @@ func ls(s systemState) (systemState, int) {
 		if filepath.Ext(f) != extn {
 			continue
 		}
-		ls += f[:len(f)-4] + "  "
+		ls += strings.TrimSuffix(f, extn) + "  "
 	}
 	if len(ls) == 0 {
 		msg("no files")
@@ -613,18 +1077,306 @@ func saveTempFile(t systemState, l int) {
 		return
 	}
 	// save listing as <n>.syt for the reload
+	writeTempFile(t.dispListing, t.hasOperand, l)
+}
+
+// writeTempFile is written to a temporary name and renamed, so the reload never sees a partial file
+func writeTempFile(dl listing, hasOperand map[string]bool, l int) {
 	f := sf("%s/%d.syt", tempDir, l)
+	tmp := sf("%s/.%d.syt.tmp", tempDir, l)
+	if rr := os.WriteFile(tmp, []byte(listingText(dl, hasOperand)), 0666); e(rr) {
+		msg("%v", rr)
+		return
+	}
+	if rr := os.Rename(tmp, f); e(rr) {
+		msg("%v", rr)
+	}
+}
+
+// listingText formats a listing as .syt, one operation per line
+func listingText(l listing, hasOperand map[string]bool) string {
 	content := ""
-	for _, d := range t.dispListing {
+	for _, d := range l {
 		content += d.Op
-		if y := t.hasOperand[d.Op]; y {
+		if y := hasOperand[d.Op]; y {
 			content += " " + d.Opd
 		}
 		content += "\n"
 	}
-	if rr := os.WriteFile(f, []byte(content), 0666); e(rr) {
+	return content
+}
+
+const exportDir = "./listings"
+
+// exportListing writes a running listing to exportDir/<name>.syt, to be loaded with `load listings/<name>`
+func exportListing(t systemState) (systemState, int) {
+	a, ok := modeArg()
+	if !ok {
+		return t, startNewOperation
+	}
+	n, rr := strconv.Atoi(a)
+	if e(rr) || n < 0 || n >= len(t.dispListings) || t.dispListings[n][0].Op == "deleted" {
+		msg("%s %sout of range%s", a, italic, reset)
+		return t, startNewOperation
+	}
+	name, ok := modeArg()
+	if !ok {
+		msg("%sexport needs a name, eg.%s : export %d name", italic, reset, n)
+		return t, startNewOperation
+	}
+	name = strings.TrimSuffix(name, ".syt")
+	if name != filepath.Base(name) {
+		msg("%sname can't contain a path:%s %s", italic, reset, name)
+		return t, startNewOperation
+	}
+	if rr := os.MkdirAll(exportDir, 0755); e(rr) {
 		msg("%v", rr)
+		return t, startNewOperation
 	}
+	f := exportDir + "/" + name + ".syt"
+	if _, rr := os.Stat(f); rr == nil {
+		msg("%s%s exists, overwrite? y/n%s", italic, f, reset)
+		if y, _ := modeArg(); y != "y" && y != "yes" {
+			msg("%snot exported%s", italic, reset)
+			return t, startNewOperation
+		}
+	}
+	if rr := os.WriteFile(f, []byte(listingText(t.dispListings[n], t.hasOperand)), 0666); e(rr) {
+		msg("%v", rr)
+		return t, startNewOperation
+	}
+	msg("%slisting %d exported to%s %s", italic, n, reset, f)
+	return t, startNewOperation
+}
+
+// sigsRequest reads the signals of listing i from the sound engine if sigs is nil, or
+// writes sigs to them. The reply is nil if there is no such listing, otherwise the signals
+type sigsRequest struct {
+	i     int
+	sigs  []float64
+	reply chan []float64
+}
+
+type snapshot struct {
+	Listing listing // as input, to check it hasn't changed since
+	Sigs    []float64
+}
+
+const sigsTimeout = time.Second // sound engine doesn't receive requests while paused
+
+func requestSigs(i int, sigs []float64) ([]float64, bool) {
+	rq := sigsRequest{i, sigs, make(chan []float64, 1)}
+	select {
+	case sigsReq <- rq:
+	case <-time.After(sigsTimeout):
+		msg("%ssound engine not responding, paused?%s", italic, reset)
+		return nil, not
+	}
+	r := <-rq.reply
+	return r, r != nil
+}
+
+func snapshotIndex(t systemState) (int, bool) {
+	a, ok := modeArg()
+	if !ok {
+		return 0, not
+	}
+	n, rr := strconv.Atoi(a)
+	if e(rr) || n < 0 || n >= len(t.dispListings) || t.dispListings[n][0].Op == "deleted" || !started {
+		msg("%s %sout of range%s", a, italic, reset)
+		return 0, not
+	}
+	return n, yes
+}
+
+// snapshotListing saves the signals of a running listing to tempDir, so that an evolved
+// state can be restored later, even after a restart
+func snapshotListing(t systemState) (systemState, int) {
+	n, ok := snapshotIndex(t)
+	if !ok {
+		return t, startNewOperation
+	}
+	sigs, ok := requestSigs(n, nil)
+	if !ok {
+		return t, startNewOperation
+	}
+	f := sf("%s/%d.snapshot.json", tempDir, n)
+	if !saveJson(snapshot{Listing: t.dispListings[n], Sigs: sigs}, f) {
+		return t, startNewOperation
+	}
+	msg("%ssnapshot of listing %d saved to%s %s", italic, n, reset, f)
+	return t, startNewOperation
+}
+
+// restoreListing writes signals saved by snapshotListing back to the listing,
+// provided it is unchanged
+func restoreListing(t systemState) (systemState, int) {
+	n, ok := snapshotIndex(t)
+	if !ok {
+		return t, startNewOperation
+	}
+	f := sf("%s/%d.snapshot.json", tempDir, n)
+	j, rr := os.ReadFile(f)
+	if e(rr) {
+		msg("%sno snapshot of listing%s %d", italic, reset, n)
+		return t, startNewOperation
+	}
+	var sn snapshot
+	if rr := json.Unmarshal(j, &sn); e(rr) {
+		msg("%s: %v", f, rr)
+		return t, startNewOperation
+	}
+	if !sameListing(sn.Listing, t.dispListings[n]) {
+		msg("%slisting %d has changed since snapshot, not restored%s", italic, n, reset)
+		return t, startNewOperation
+	}
+	if _, ok := requestSigs(n, sn.Sigs); !ok {
+		return t, startNewOperation
+	}
+	msg("%slisting %d restored from snapshot%s", italic, n, reset)
+	return t, startNewOperation
+}
+
+func sameListing(a, b listing) bool {
+	if len(a) != len(b) {
+		return not
+	}
+	for i := range a {
+		if a[i].Op != b[i].Op || a[i].Opd != b[i].Opd {
+			return not
+		}
+	}
+	return yes
+}
+
+// compactListings removes deleted listings, renumbering the listings that follow, along with
+// references between listings by index and their files in tempDir
+func compactListings(t systemState) (systemState, int) {
+	if len(t.newListing) > 0 {
+		msg("%sfinish the current listing before compacting%s", italic, reset)
+		return t, startNewOperation
+	}
+	index := make([]int, len(t.dispListings))
+	n := 0
+	for i, l := range t.dispListings {
+		index[i] = -1
+		if l[0].Op == "deleted" {
+			continue
+		}
+		index[i] = n
+		n++
+	}
+	switch {
+	case !started || n == len(index):
+		msg("%sno deleted listings%s", italic, reset)
+		return t, startNewOperation
+	case n == 0:
+		msg("%sall listings are deleted, nothing would remain%s", italic, reset)
+		return t, startNewOperation
+	}
+	t, ok := removeListings(t, index, n)
+	if !ok {
+		return t, startNewOperation
+	}
+	msg("%s%d deleted listings removed, %d remaining%s", italic, len(index)-n, n, reset)
+	return t, startNewOperation
+}
+
+// removeListings removes listings with a new index of -1 from the sound engine, leaving n.
+// The listings that follow are renumbered, along with references between listings by index
+// and their files in tempDir
+func removeListings(t systemState, index []int, n int) (systemState, bool) {
+	dispListings, verbose := make([]listing, 0, n), make([]listing, 0, n)
+	changed := make([]bool, len(index))
+	for i := range t.dispListings {
+		if index[i] < 0 {
+			continue
+		}
+		opn := map[string]int{} // operators is out of reach here, so found from the compiled listing
+		for _, o := range t.verbose[i] {
+			opn[o.Op] = o.Opn
+		}
+		dl, nd := renumber(t.dispListings[i], opn, index)
+		v, nv := renumber(t.verbose[i], opn, index)
+		switch {
+		case nd < 0 || nv < 0:
+			msg("%slisting %d refers to a removed listing, not compacted%s", italic, i, reset)
+			return t, not
+		case nd != nv:
+			msg("%slisting %d refers to a listing within a function, not compacted%s", italic, i, reset)
+			return t, not
+		}
+		dispListings, verbose = append(dispListings, dl), append(verbose, v)
+		changed[i] = index[i] != i || nd > 0
+	}
+	if display.Paused { // play resumed to enact compaction
+		<-pause
+		display.Paused = not
+	}
+	lockLoad <- struct{}{} // also holds off the reload while files are renumbered
+	compactReq <- index
+	<-accepted
+	unsolo := t.unsolo[:0]
+	for i, m := range t.unsolo {
+		if i < len(index) && index[i] > -1 {
+			unsolo = append(unsolo, m)
+		}
+	}
+	if t.solo > -1 && t.solo < len(index) {
+		t.solo = index[t.solo]
+	}
+	t.dispListings, t.verbose, t.unsolo = dispListings, verbose, unsolo
+	for i := range index {
+		sn, snTo := sf("%s/%d.snapshot.json", tempDir, i), sf("%s/%d.snapshot.json", tempDir, index[i])
+		switch {
+		case index[i] < 0:
+			os.Remove(sn)
+		case index[i] != i:
+			if rr := os.Rename(sn, snTo); e(rr) {
+				os.Remove(snTo) // stale
+			}
+		}
+		if changed[i] && !t.ephemeral {
+			writeTempFile(t.dispListings[index[i]], t.hasOperand, index[i])
+		}
+		if i >= n {
+			os.Remove(sf("%s/%d.syt", tempDir, i))
+		}
+	}
+	<-lockLoad
+	if t.ephemeral {
+		return t, yes
+	}
+	if !saveJson(t.dispListings, "displaylisting.json") {
+		msg("%slisting display not updated, check file %s'displaylisting.json'%s exists%s",
+			italic, reset, italic, reset)
+	}
+	return t, yes
+}
+
+// renumber returns a copy of l with references to listings by index renumbered,
+// and the count of references changed, or -1 if one refers to a removed listing
+func renumber(l listing, opn map[string]int, index []int) (listing, int) {
+	r := make(listing, len(l))
+	copy(r, l)
+	c := 0
+	for i, o := range l {
+		if !indexOps[opn[o.Op]] {
+			continue
+		}
+		n, rr := strconv.Atoi(o.Opd)
+		if e(rr) || n < 0 || n >= len(index) {
+			continue
+		}
+		if index[n] < 0 {
+			return r, -1
+		}
+		if index[n] != n {
+			r[i].Opd = strconv.Itoa(index[n])
+			c++
+		}
+	}
+	return r, c
 }
 
 func loadUsage() map[string]int {
@@ -658,7 +1410,7 @@ type pair struct {
 }
 type pairs []pair
 
-func saveUsage(u map[string]int, t systemState) {
+func sortUsage(u map[string]int) pairs {
 	p := make(pairs, len(u))
 	i := 0
 	for k, v := range u {
@@ -666,8 +1418,12 @@ func saveUsage(u map[string]int, t systemState) {
 		i++
 	}
 	sort.Slice(p, func(i, j int) bool { return p[i].Value > p[j].Value })
+	return p
+}
+
+func saveUsage(u map[string]int, t systemState) {
 	data := ""
-	for _, s := range p {
+	for _, s := range sortUsage(u) {
 		data += sf("%s %d\n", s.Key, s.Value)
 	}
 	data += "\nunused:\n"
@@ -688,6 +1444,31 @@ func saveUsage(u map[string]int, t systemState) {
 	}
 }
 
+const usageShown = 12
+
+// showUsage prints the most used operators and functions to the terminal, counts include
+// those saved in 'usage.txt' from previous sessions
+func showUsage(u map[string]int, t systemState) {
+	p := sortUsage(u)
+	if len(p) > usageShown {
+		p = p[:usageShown]
+	}
+	for _, s := range p {
+		pf("%s%-10s%s%d\n", italic, s.Key, reset, s.Value)
+	}
+	unused := []string{}
+	for f := range t.funcs {
+		if _, in := u[f]; !in {
+			unused = append(unused, f)
+		}
+	}
+	sort.Strings(unused)
+	if len(unused) > 0 {
+		pf("%sunused functions:%s %s\n", italic, reset, strings.Join(unused, " "))
+	}
+	msg("%susage listed in terminal%s", italic, reset)
+}
+
 func loadReloadAppend(t systemState) (systemState, int) {
 	switch t.operator {
 	case "rld", "r":
@@ -697,10 +1478,6 @@ func loadReloadAppend(t systemState) (systemState, int) {
 			return t, startNewOperation
 		}
 		t.reload = n
-		if len(mutes) > t.reload && !display.Paused {
-			mutes[t.reload] = 0
-			time.Sleep(10 * time.Millisecond)
-		}
 		t.operand = tempDir + "/" + t.operand
 	case "apd":
 		t.reload = -1
@@ -712,11 +1489,213 @@ func loadReloadAppend(t systemState) (systemState, int) {
 		t.reload = -1
 		return t, startNewOperation
 	}
-	s := bufio.NewScanner(inputF)
-	s.Split(bufio.ScanWords)
+	sections := splitSet(inputF)
+	inputF.Close()
+	n := 0
+	for _, ws := range sections {
+		n += len(ws)
+	}
+	if !tokenSpace(n) { // tokens are read by this goroutine, so sending would never return
+		msg("%s%s.syt is too long to load:%s %d tokens", italic, t.operand, reset, n)
+		t.reload = -1
+		return t, startNewOperation
+	}
+	if t.reload > -1 { // don't replace a running listing with a partial or broken file
+		if len(sections) == 0 || !endsListing(sections[len(sections)-1], t) {
+			msg("%s%s.syt is incomplete, not reloaded%s", italic, t.operand, reset)
+			t.reload = -1
+			return t, startNewOperation
+		}
+		if len(mutes) > t.reload && !display.Paused {
+			mutes[t.reload] = 0
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	if len(sections) > 1 { // set of listings, each must be complete
+		for i, ws := range sections[:len(sections)-1] {
+			if !endsListing(ws, t) {
+				msg("%slisting %d in%s %s.syt %sis incomplete, not loaded%s", italic, i, reset, t.operand, italic, reset)
+				t.reload = -1
+				return t, startNewOperation
+			}
+		}
+		msg("%sloading %d listings%s", italic, len(sections), reset)
+	}
+	for _, ws := range sections {
+		for _, w := range ws {
+			tokens <- token{w, t.reload, yes}
+		}
+	}
+	return t, startNewListing
+}
+
+const setSeparator = "---"
+
+// splitSet splits a .syt file into the tokens of each listing, separated by lines of setSeparator
+func splitSet(r io.Reader) [][]string {
+	sections := [][]string{{}}
+	s := bufio.NewScanner(r)
 	for s.Scan() {
-		tokens <- token{s.Text(), t.reload, yes}
+		ws := strings.Fields(s.Text())
+		if len(ws) == 1 && ws[0] == setSeparator {
+			sections = append(sections, []string{})
+			continue
+		}
+		sections[len(sections)-1] = append(sections[len(sections)-1], ws...)
+	}
+	n := 0
+	for _, ws := range sections { // remove empty sections
+		if len(ws) > 0 {
+			sections[n] = ws
+			n++
+		}
+	}
+	return sections[:n]
+}
+
+// endsListing reports whether the last operation of ws will launch a listing
+func endsListing(ws []string, t systemState) bool {
+	var last operation
+	for i := 0; i < len(ws); i++ {
+		last = operation{Op: strings.TrimSuffix(ws[i], ",")}
+		if t.hasOperand[last.Op] && i+1 < len(ws) {
+			i++
+			last.Opd = strings.TrimSuffix(ws[i], ",")
+		}
+	}
+	if f, in := t.funcs[last.Op]; in && len(f.Body) > 0 {
+		last = f.Body[len(f.Body)-1]
+	}
+	switch last.Op {
+	case "out":
+		return last.Opd == "dac"
+	case ".out", ".>sync", ".level", ".lvl", ".pan", "//":
+		return yes
+	}
+	return not
+}
+
+const recallLength = 9 // number of recent launches listed, fits info display
+
+// recentRecordings returns listing recordings, most recent first. Deletions are excluded
+func recentRecordings(dir string) ([]string, error) {
+	recs, rr := listingRecordings(dir)
+	if e(rr) {
+		return nil, rr
+	}
+	names := make([]string, 0, len(recs))
+	for _, r := range recs {
+		l, _, ok := loadRecording(dir + r)
+		if !ok || len(l) == 0 || l[0].Op == "deleted" {
+			continue
+		}
+		names = append(names, r)
+	}
+	return names, nil
+}
+
+// listingRecordings returns the names of all listing recordings, most recent first
+func listingRecordings(dir string) ([]string, error) {
+	files, rr := os.ReadDir(dir)
+	if e(rr) {
+		return nil, rr
+	}
+	type rec struct {
+		name string
+		mod  time.Time
+	}
+	var recs []rec
+	for _, file := range files {
+		f := file.Name()
+		if file.IsDir() || !strings.HasPrefix(f, "listing.") || filepath.Ext(f) != ".json" {
+			continue
+		}
+		inf, rr := file.Info()
+		if e(rr) {
+			continue
+		}
+		recs = append(recs, rec{f, inf.ModTime()})
+	}
+	sort.Slice(recs, func(i, j int) bool { return recs[i].mod.After(recs[j].mod) })
+	names := make([]string, 0, len(recs))
+	for _, r := range recs {
+		names = append(names, r.name)
+	}
+	return names, nil
+}
+
+const defaultMaxRecordings = 10000 // kept by --max-recordings without a number
+
+// pruneRecordings removes the oldest listing recordings beyond max, returning the number removed
+func pruneRecordings(dir string, max int) int {
+	recs, rr := listingRecordings(dir)
+	if e(rr) || len(recs) <= max {
+		return 0
+	}
+	n := 0
+	for _, r := range recs[max:] {
+		if rr := os.Remove(dir + r); !e(rr) {
+			n++
+		}
+	}
+	return n
+}
+
+// loadRecording accepts the unversioned format, a bare listing, as well as the current format
+func loadRecording(f string) (listing, int, bool) {
+	j, rr := os.ReadFile(f)
+	if e(rr) {
+		return nil, 0, not
+	}
+	var r recording
+	if rr := json.Unmarshal(j, &r.Listing); !e(rr) {
+		return r.Listing, 0, yes
+	}
+	if rr := json.Unmarshal(j, &r); e(rr) {
+		return nil, 0, not
+	}
+	return r.Listing, r.Version, yes
+}
+
+// recall lists recent launches, or relaunches the k-th most recent as a new listing
+func recall(t systemState) (systemState, int) {
+	dir := "./recordings/"
+	recs, rr := recentRecordings(dir)
+	if e(rr) {
+		msg("unable to access '%s': %s", dir, rr)
+		return t, startNewOperation
+	}
+	if len(recs) == 0 {
+		msg("%sno recorded listings%s", italic, reset)
+		return t, startNewOperation
+	}
+	switch t.operand {
+	case "", "l", "ls":
+		for k := 0; k < len(recs) && k < recallLength; k++ {
+			l, _, _ := loadRecording(dir + recs[k])
+			ts := strings.TrimSuffix(strings.TrimPrefix(recs[k], "listing."), ".json")
+			msg("%d: %s%s%s  %d operations", k, italic, ts, reset, len(l))
+		}
+		return t, startNewOperation
+	}
+	k, rr := strconv.Atoi(t.operand)
+	if e(rr) || k < 0 || k >= len(recs) {
+		msg("%s %sout of range%s", t.operand, italic, reset)
+		return t, startNewOperation
+	}
+	l, v, ok := loadRecording(dir + recs[k])
+	if !ok {
+		msg("%sunable to load%s %s", italic, reset, recs[k])
+		return t, startNewOperation
+	}
+	if w := upgrade(recs[k], v); w != "" {
+		msg("%s", w)
+	}
+	for _, o := range l {
+		tokens <- token{o.Op, -1, yes}
+		if t.hasOperand[o.Op] {
+			tokens <- token{o.Opd, -1, yes}
+		}
 	}
-	inputF.Close()
 	return t, startNewListing
 }
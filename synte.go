@@ -5,7 +5,8 @@
 	fusing many tiny elements together under intense heat
 
 	The input syntax is in EBNF = operator " " [ [","] operand [","] " " ] .
-	Where an operand can be a ( name = letter { letter | digit } ) | ( number = float  ["/" float ] [type] ) .
+	Where an operand can be a ( name = letter { letter | digit | "." } ) | ( number = float { ( "+" | "-" | "*" | "/" ) float } [type] ) .
+	Expressions in a number may also include parentheses and unary signs, eg. -(1+2)*3
 	A letter is defined as any UTF-8 character excluding + - . 0 1 2 3 4 5 6 7 8 9
 	A float matches the floating point literal in the Go language specification.
 	A type can be one of the following tokens: "hz", "s", "ms", "bpm", "db", "!" .
@@ -58,12 +59,16 @@ import (
 	"io"
 	"math"
 	"math/cmplx"
+	"net"
 	"os"
+	"os/signal"
 	"runtime"
 	"runtime/debug"
 	"runtime/pprof"
+	"sort"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 	"unicode"
 )
@@ -88,7 +93,10 @@ const ( // operating system
 	SNDCTL_DSP_CHANNELS = 0xC0045003
 	STEREO              = 1
 	MONO                = 0
-	CHANNELS            = STEREO // will halve pitches/frequencies/tempos if mono!
+	CHANNELS            = STEREO // default, see --mono
+	// for more than two channels, see --quad
+	SNDCTL_DSP_SETCHANNELS = 0xC0045006
+	QUAD                   = 4
 	// set Sample Rate, specific rate defined below
 	// SNDCTL_DSP_SPEED	= IOC_INOUT |(0x04 & ((1 << 13)-1))<<16 | 0x50 << 8 | 0x02
 	SNDCTL_DSP_SPEED       = 0xC0045002
@@ -98,7 +106,7 @@ const ( // operating system
 	WAV_TIME      = 4 //seconds
 	TAPE_LENGTH   = 1 //seconds
 	MAX_WAVS      = 12
-	lenReserved   = 11
+	lenReserved   = 17
 	maxExports    = 12
 	DEFAULT_FREQ  = 0.0625 // 3kHz @ 48kHz Sample rate
 	FDOUT         = 1e-4
@@ -109,6 +117,9 @@ const ( // operating system
 	twoInvMaxUint = 2.0 / math.MaxUint64
 	alpLen        = 2400
 	baseGain      = 1.0
+	autoGainRef   = 0.25 // -12dB rms, target of `: autogain`
+	autoGainTime  = 3    // seconds, time constant of level detection and gain
+	autoGainRange = 4    // ±12dB
 )
 
 var SampleRate float64 = SAMPLE_RATE // should be 'de-globalised'
@@ -168,9 +179,9 @@ type listingState struct {
 	newOperation
 	fIn bool // yes = inside function definition
 	st, // func def start
-	funCount,
 	do, to int
 	muteGroup []int // new mute group
+	marks     []int // len of newListing before each operation of dispListing, for <<
 }
 
 type fn struct {
@@ -183,15 +194,19 @@ type systemState struct {
 	verbose         []listing // for tools/listings.go
 	wmap            map[string]bool
 	wavNames        string // for display purposes
+	wavSlice        wavs   // in order of index, see `: rewav`
 	funcs           map[string]fn
 	funcsave        bool
 	solo            int // index of most recent solo
 	unsolo          muteSlice
 	hasOperand      map[string]bool
+	docs            map[string]string // of operators, for `: help`
+	usage           map[string]int    // live telemetry, for `: usage`
 	daisyChains     []int
 	tapeLen         int
 	lenExported     int
 	exportedSignals map[string]int
+	ephemeral       bool // don't save listings to .temp, used by Engine
 	listingState
 	soundcard
 }
@@ -202,106 +217,139 @@ type operatorCheck struct {
 	Opd     bool // indicates if has operand
 	N       int  // index for sound engine switch
 	process processor
+	doc     string // shown by `: help`
 }
 
 var operators = map[string]operatorCheck{ // would be nice if switch indexes could be generated from a common root
 	// this map is effectively a constant and not mutated
-	//name  operand N  process           comment
-	"+":      {yes, 1, noCheck},       // add
-	"out":    {yes, 2, checkOut},      // send to named signal
-	".out":   {yes, 2, checkOut},      // alias of out
-	"out+":   {yes, 3, checkOut},      // add to named signal
-	"in":     {yes, 4, checkIn},       // input numerical value or receive from named signal
-	"sine":   {not, 5, noCheck},       // shape linear input to sine
-	"mod":    {yes, 6, noCheck},       // output = input MOD operand
-	"gt":     {yes, 7, noCheck},       // greater than
-	"lt":     {yes, 8, noCheck},       // less than
-	"mul":    {yes, 9, noCheck},       // multiply
-	"*":      {yes, 9, noCheck},       // alias of mul
-	"x":      {yes, 9, noCheck},       // alias of mul
-	"abs":    {not, 10, noCheck},      // absolute
-	"tanh":   {not, 11, noCheck},      // hyperbolic tangent
-	"pow":    {yes, 12, noCheck},      // power
-	"base":   {yes, 13, noCheck},      // operand to the power of input
-	"clip":   {yes, 14, noCheck},      // clip input
-	"nois":   {not, 15, noCheck},      // white noise source
-	"push":   {not, 16, noCheck},      // push to listing stack
-	"pop":    {not, 17, checkPushPop}, // pop from listing stack
-	"buff":   {yes, 18, buffUnique},   // listing buff loop
-	"--":     {yes, 19, noCheck},      // subtract from operand
-	"tap":    {yes, 20, noCheck},      // tap from loop
-	"f2c":    {not, 21, noCheck},      // convert frequency to co-efficient
-	"wav":    {yes, 22, checkWav},     // play wav file
-	"8bit":   {yes, 23, noCheck},      // quantise input
-	"index":  {not, 24, noCheck},      // index of listing // change to signal?
-	"<sync":  {yes, 25, noCheck},      // receive sync pulse
-	">sync":  {not, 26, noCheck},      // send sync pulse
-	".>sync": {not, 26, noCheck},      // alias, launches listing
+	//name  operand N  process           doc
+	"+":      {yes, 1, noCheck, "add"},
+	"bias":   {yes, 1, checkBias, "add a constant"},
+	"out":    {yes, 2, checkOut, "send to named signal"},
+	".out":   {yes, 2, checkOut, "alias of out"},
+	"out+":   {yes, 3, checkOut, "add to named signal"},
+	"out-":   {yes, 79, checkOut, "subtract from named signal"},
+	"in":     {yes, 4, checkIn, "input numerical value or receive from named signal"},
+	"sine":   {not, 5, noCheck, "shape linear input to sine"},
+	"mod":    {yes, 6, noCheck, "output = input MOD operand"},
+	"wrap":   {yes, 63, noCheck, "floored modulo, wraps input into [0, operand)"},
+	"srr":    {yes, 64, srrUnique, "sample rate reduction, holds input"},
+	"push!":  {not, 65, noCheck, "push to persistent listing stack"},
+	"pop!":   {not, 66, noCheck, "pop from persistent listing stack"},
+	"gt":     {yes, 7, noCheck, "greater than"},
+	"lt":     {yes, 8, noCheck, "less than"},
+	"mul":    {yes, 9, noCheck, "multiply"},
+	"*":      {yes, 9, noCheck, "alias of mul"},
+	"x":      {yes, 9, noCheck, "alias of mul"},
+	"abs":    {not, 10, noCheck, "absolute"},
+	"tanh":   {not, 11, noCheck, "hyperbolic tangent"},
+	"pow":    {yes, 12, noCheck, "power"},
+	"base":   {yes, 13, noCheck, "operand to the power of input"},
+	"clip":   {yes, 14, noCheck, "clip input"},
+	"nois":   {not, 15, noCheck, "white noise source"},
+	"pnois":  {not, 70, noCheck, "pink noise source, -3dB per octave"},
+	"bnois":  {not, 71, noCheck, "brown noise source, -6dB per octave"},
+	"push":   {not, 16, noCheck, "push to listing stack"},
+	"pop":    {not, 17, checkPushPop, "pop from listing stack"},
+	"buff":   {yes, 18, buffLimit, "listing buff loop"},
+	"--":     {yes, 19, noCheck, "subtract from operand"},
+	"tap":    {yes, 20, noCheck, "tap from loop"},
+	"f2c":    {not, 21, noCheck, "convert frequency to co-efficient"},
+	"wav":    {yes, 22, checkWavIndex, "play wav file, by name or index"},
+	"8bit":   {yes, 23, noCheck, "quantise input"},
+	"index":  {not, 24, noCheck, "index of listing"}, // change to signal?
+	"<sync":  {yes, 25, noCheck, "receive sync pulse"},
+	">sync":  {not, 26, noCheck, "send sync pulse"},
+	".>sync": {not, 26, noCheck, "alias, launches listing"},
 	//	"jl0":    {yes, 27, noCheck},    // jump if less than zero
-	"level":  {yes, 28, checkIndexIncl}, // vary level of a listing
-	".level": {yes, 28, checkIndexIncl}, // alias, launches listing
-	"lvl":    {yes, 28, checkIndexIncl}, // vary level of a listing
-	".lvl":   {yes, 28, checkIndexIncl}, // alias, launches listing
-	"from":   {yes, 29, checkIndex},     // receive output from a listing
-	"sgn":    {not, 30, noCheck},        // sign of input
-	"log":    {not, 31, noCheck},        // base-2 logarithm of input
-	"/":      {yes, 32, noCheck},        // division
-	"sub":    {yes, 33, noCheck},        // subtract operand
-	"-":      {yes, 33, noCheck},        // alias of sub
-	"setmix": {yes, 34, noCheck},        // set sensible level
-	"print":  {not, 35, noCheck},        // print input to info display
-	"\\":     {yes, 36, noCheck},        // "\"
-	"pan":    {yes, 38, checkIndexIncl}, // vary pan of a listing
-	".pan":   {yes, 38, checkIndexIncl}, // alias, launches listing
-	"all":    {not, 39, checkIndex},     // receive output of all preceding listings
-	"fft":    {not, 40, noCheck},        // create fourier transform
-	"ifft":   {not, 41, noCheck},        // receive from fourier representation
-	"fftrnc": {yes, 42, noCheck},        // truncate spectrum
-	"shfft":  {yes, 43, noCheck},        // shift spectrum
-	"ffrz":   {yes, 44, noCheck},        // freeze-hold spectrum
-	"gafft":  {yes, 45, noCheck},        // gate spectrum
-	"rev":    {not, 46, noCheck},        // reverse spectrum
-	"ffltr":  {yes, 47, noCheck},        // apply weighted average filter to spectrum
-	"ffzy":   {not, 48, noCheck},        // rotate phases by random values
-	"ffaze":  {yes, 49, noCheck},        // rotate phases by operand
-	"reu":    {not, 50, noCheck},        // reverse each half of complex spectrum
-	"halt":   {not, 51, noCheck},        // halt sound engine for time specified by input (experimental)
-	"4lp":    {not, 52, checkAlp},        // prototype all-pass filter, to allow 4 buffers in one listing for this specific purpose
-	"panic":  {not, 53, noCheck},        // artificially induce a SE panic, for testing
+	"level":  {yes, 28, checkIndexIncl, "vary level of a listing"},
+	".level": {yes, 28, checkIndexIncl, "alias, launches listing"},
+	"lvl":    {yes, 28, checkIndexIncl, "vary level of a listing"},
+	".lvl":   {yes, 28, checkIndexIncl, "alias, launches listing"},
+	"from":   {yes, 29, checkIndex, "receive output from a listing"},
+	"from~":  {yes, 69, fromUnique, "receive output from a listing, smoothed"},
+	"sgn":    {not, 30, noCheck, "sign of input"},
+	"log":    {not, 31, noCheck, "base-2 logarithm of input"},
+	"/":      {yes, 32, noCheck, "division"},
+	"sub":    {yes, 33, noCheck, "subtract operand"},
+	"-":      {yes, 33, noCheck, "alias of sub"},
+	"setmix": {yes, 34, noCheck, "set sensible level"},
+	"print":  {not, 35, noCheck, "print input to info display"},
+	"\\":     {yes, 36, noCheck, "output = operand / input"},
+	"pan":    {yes, 38, checkIndexIncl, "vary pan of a listing"},
+	".pan":   {yes, 38, checkIndexIncl, "alias, launches listing"},
+	"depth":  {yes, 68, checkIndexIncl, "vary front to back pan of a listing, quad output only"},
+	".depth": {yes, 68, checkIndexIncl, "alias, launches listing"},
+	"all":    {not, 39, checkIndex, "receive output of all preceding listings"},
+	"fft":    {not, 40, noCheck, "create fourier transform"},
+	"ifft":   {not, 41, noCheck, "receive from fourier representation"},
+	"fftrnc": {yes, 42, noCheck, "truncate spectrum"},
+	"shfft":  {yes, 43, noCheck, "shift spectrum"},
+	"ffrz":   {yes, 44, noCheck, "freeze-hold spectrum"},
+	"gafft":  {yes, 45, noCheck, "gate spectrum"},
+	"rev":    {not, 46, noCheck, "reverse spectrum"},
+	"ffltr":  {yes, 47, noCheck, "apply weighted average filter to spectrum"},
+	"ffzy":   {not, 48, noCheck, "rotate phases by random values"},
+	"ffaze":  {yes, 49, noCheck, "rotate phases by operand"},
+	"reu":    {not, 50, noCheck, "reverse each half of complex spectrum"},
+	"halt":   {not, 51, noCheck, "halt sound engine for time specified by input (experimental)"},
+	"4lp":    {not, 52, checkAlp, "prototype all-pass filter, to allow 4 buffers in one listing for this specific purpose"},
+	"panic":  {not, 53, noCheck, "artificially induce a SE panic, for testing"},
+	"pulse@": {yes, 54, pulseUnique, "free-running single sample pulse train, independent of tempo"},
+	"trig":   {not, 72, perListingUnique, "single sample pulse when input rises above zero"},
+	"trig-":  {not, 73, perListingUnique, "single sample pulse when input falls to zero or below"},
+	"div":    {yes, 74, perListingUnique, "pulse on every nth rising input, n given by operand"},
+	"euc":    {yes, 75, perListingUnique, "euclidean rhythm stepped by rising input, hits given by operand, see `eusteps`"},
+	"chance": {yes, 77, perListingUnique, "pass input with probability given by operand, decided on each rising edge"},
+	"seq":    {yes, 78, checkSeq, "step through comma separated values given by operand on each rising edge"},
+	"compress": {yes, 55, perListingUnique, "compress input above threshold given by operand, see `comp`"},
+	"cratio":   {yes, 56, noCheck, "set compression ratio"},
+	"cattack":  {yes, 57, noCheck, "set compressor attack"},
+	"crelease": {yes, 58, noCheck, "set compressor release"},
+	"duck":     {yes, 59, duckUnique, "attenuate input keyed by output of a listing"},
+	"peak":     {yes, 60, perListingUnique, "peaking filter at centre frequency given by operand, see `peq`"},
+	"pkgain":   {yes, 61, noCheck, "set gain of peaking filter"},
+	"pkq":      {yes, 62, noCheck, "set Q of peaking filter"},
+	"eusteps":  {yes, 76, noCheck, "set steps of euclidean rhythm"},
+	"stretch":  {yes, 67, stretchUnique, "play wav at original pitch from position given by input"},
+	"sratio":   {yes, 80, noCheck, "set duration of stretch as a multiple of the wav's, which then plays by itself"},
 
 	// specials. Not intended for sound engine, except 'deleted'
-	"]":       {not, 0, endFunctionDefine},   // end function input
-	":":       {yes, 0, modeSet},             // command
-	"fade":    {yes, 0, checkFade},           // set fade out
-	"del":     {yes, 0, enactDelete},         // delete a listing
-	"erase":   {yes, 0, eraseOperations},     // erase a listing
-	"mute":    {yes, 0, enactMute},           // mute a listing
-	"m":       {yes, 0, enactMute},           // alias of mute
-	"solo":    {yes, 0, enactSolo},           // solo a listing
-	"release": {yes, 0, checkRelease},        // set limiter release
-	"unmute":  {not, 0, unmuteAll},           // unmute all listings
-	"unsolo":  {not, 0, unmuteAll},           // alias for unmute all listings
-	".mute":   {yes, 0, enactMute},           // alias, launches listing
-	".del":    {yes, 0, enactDelete},         // alias, launches listing
-	".solo":   {yes, 0, enactSolo},           // alias, launches listing
-	"//":      {yes, 0, checkComment},        // comments
-	"load":    {yes, 0, loadReloadAppend},    // load listing by filename
-	"ld":      {yes, 0, loadReloadAppend},    // alias of load
-	"[":       {yes, 0, beginFunctionDefine}, // begin function input
-	"ls":      {yes, 0, ls},                  // list listings
-	"ct":      {yes, 0, adjustClip},          // individual clip threshold
-	"rld":     {yes, 0, loadReloadAppend},    // reload a listing
-	"r":       {yes, 0, loadReloadAppend},    // alias of rld
-	"s":       {yes, 0, enactSolo},           // alias of solo
-	"e":       {yes, 0, eraseOperations},     // alias of erase
-	"apd":     {yes, 0, loadReloadAppend},    // launch index to new listing
-	"do":      {yes, 0, doLoop},              // repeat next operation [operand] times
-	"d":       {yes, 0, enactDelete},         // alias of del
-	"deleted": {not, 0, noCheck},             // for internal use
-	"m+":      {yes, 0, enactMute},           // add to mute group
-	"gain":    {yes, 0, adjustGain},          // set overall mono gain before limiter
-	"record":  {yes, 0, recordWav},           // commence recording of wav file
-	"wait":    {yes, 0, enactWait},           // for testing scripts, rounded to Milliseconds
+	"]":       {not, 0, endFunctionDefine, "end function input"},
+	":":       {yes, 0, modeSet, "command"},
+	"fade":    {yes, 0, checkFade, "set fade out"},
+	"del":     {yes, 0, enactDelete, "delete a listing"},
+	"erase":   {yes, 0, eraseOperations, "erase the last n operations"},
+	"mute":    {yes, 0, enactMute, "mute a listing"},
+	"m":       {yes, 0, enactMute, "alias of mute"},
+	"solo":    {yes, 0, enactSolo, "solo a listing"},
+	"release": {yes, 0, checkRelease, "set limiter release"},
+	"unmute":  {not, 0, unmuteAll, "unmute all listings"},
+	"unsolo":  {not, 0, unmuteAll, "alias for unmute all listings"},
+	".mute":   {yes, 0, enactMute, "alias, launches listing"},
+	".del":    {yes, 0, enactDelete, "alias, launches listing"},
+	".solo":   {yes, 0, enactSolo, "alias, launches listing"},
+	"//":      {yes, 0, checkComment, "comments"},
+	"load":    {yes, 0, loadReloadAppend, "load listing by filename"},
+	"ld":      {yes, 0, loadReloadAppend, "alias of load"},
+	"[":       {yes, 0, beginFunctionDefine, "begin function input"},
+	"ls":      {yes, 0, ls, "list listings"},
+	"ct":      {yes, 0, adjustClip, "individual listing limiter threshold"},
+	"rld":     {yes, 0, loadReloadAppend, "reload a listing"},
+	"r":       {yes, 0, loadReloadAppend, "alias of rld"},
+	"s":       {yes, 0, enactSolo, "alias of solo"},
+	"e":       {yes, 0, eraseOperations, "alias of erase"},
+	"apd":     {yes, 0, loadReloadAppend, "launch index to new listing"},
+	"do":      {yes, 0, doLoop, "repeat next operation [operand] times"},
+	"d":       {yes, 0, enactDelete, "alias of del"},
+	"deleted": {not, 0, noCheck, "for internal use"},
+	"m+":      {yes, 0, enactMute, "add to mute group"},
+	"bypass":  {yes, 0, enactBypass, "stop processing a listing, keeping it to resume"},
+	".bypass": {yes, 0, enactBypass, "alias, launches listing"},
+	"gain":    {yes, 0, adjustGain, "set overall mono gain before limiter"},
+	"record":  {yes, 0, recordWav, "commence recording of wav file"},
+	"wait":    {yes, 0, enactWait, "for testing scripts, interrupted by `_`"},
+	"recall":  {yes, 0, recall, "relaunch a recent listing from recordings"},
 }
 
 type syncState int
@@ -324,24 +372,47 @@ type listingStack struct {
 	listing []opSE
 	sigs    []float64
 	stack   []float64
+	pstack  []float64 // persists between samples, see push! and pop!
 	syncSt8 syncState
 	m       float64
-	buff []float64
+	buff [][]float64 // one for each buff, see buffLoops
 	alp  [alpLen]float64
 	alp1 [alpLen]float64
 	alp2 [alpLen]float64
 	alp3 [alpLen]float64
 	lv, pan,
+	depth, // front to back pan, for quad
 	peakfreq float64
 	fftArr,
-	ifftArr,
-	ifft2 [N]float64
+	ola [N]float64 // overlap-add of ifft output
+	hop int        // samples between fft frames, N/overlap
 	z, zf [N]complex128
 	ffrz  bool
 	lim, limPre,
 	limPreX float64
+	pulsePh float64 // phase of pulse@
+	fromSm  float64 // smoothed output of from~
+	brn     float64 // integrator of bnois
+	trigUp  float64 // previous input of trig
+	trigDn  float64 // previous input of trig-
+	dv      divider // of div
+	eu      euclidean
+	ch      gate // of chance
+	sq      sequence // of seq
+	cmp     compressor
+	pk      biquad
+	sr      reducer // sample rate reduction of srr
+	gr      granulator
+	pn      pinkNoise
+	no      noise   // independent of other listings, see listingNoise
+	fadeIn  float64 // soft start envelope on launch
+	hold    bool    // not processed until the next grid boundary, see `: quantise`
+	peak    float64 // peak output level since last published
+	sends   bool    // affects other listings, so is processed while muted
 }
 
+const maxPersistStack = 100 // depth of push! stack
+
 const infoBuffer = 96
 
 // communication channels
@@ -354,6 +425,12 @@ var (
 
 	info    = make(chan string, infoBuffer) // arbitrary buffer length, 48000Hz = 960 x 50Hz
 	carryOn = make(chan bool)
+	printed = make(chan string, infoBuffer) // output of print, when logged
+	sigsReq = make(chan sigsRequest)        // read or write signals of a running listing, see `: snapshot`
+	compactReq = make(chan []int)           // new index of each listing, -1 to remove, see `: compact`
+	wavBank    = make(chan [][]float64, 1)  // replaces wavs of the sound engine, see `: rewav`
+
+	cancelWait = make(chan struct{}) // interrupts `wait`, unbuffered so only received while waiting
 )
 
 type muteSlice []float64
@@ -364,16 +441,56 @@ var (
 	exit    bool // initiate shutdown
 	mutes   muteSlice
 	levels  []float64
+	bypassed []bool // listings not processed, see `bypass`
+	muteSkip = yes  // muted listings aren't processed, see `: muff`
+	limAttack = 1.0 // coefficient of limiter detection rise, see `: limiter attack`
+	masterBypass bool // limiter VCA not applied, see `: master bypass`
+	rewind bool // reset transport position, see `: rewind`
+	quantum float64 // beats of grid that launches are held to, 0 for immediate launch, see `: quantise`
+	printInterval = 32768 // samples between output of print, see `: printrate`
+	printJitter = yes // randomise print interval, to spread output of several listings
+	printLog bool // print to info log rather than info display, see `: printlog`
+	underruns int // samples output as silence as the sound engine was late, see `: stress`
 	rs      bool                                     // root-sync between running instances
 	fade    = 1 / (MIN_FADE * SAMPLE_RATE)           //Pow(FDOUT, 1/(MIN_FADE*SAMPLE_RATE))
 	release = math.Pow(8000, -1.0/(.25*SAMPLE_RATE)) // 250ms
 	gain    = baseGain
+	autoGain bool // gain follows autoGainRef slowly, see `: autogain`
+	stereoWidth = 1.0 // scales sides, up to maxWidth, see `: width`
+	overlap = 2 // of fft frames for listings launched subsequently, see `: overlap`
+	levelTime = 1 / (Tau * 1e3) // smoothing time constant of level in seconds, see `: levelsmooth`
 	clipThr = 1.0 // individual listing limiter threshold
 	rst   bool
 )
 
+const maxWidth = 2 // of stereoWidth, beyond this mono compatibility suffers
+
 type noise uint64
 
+// listingNoise seeds the noise of listing i, the same each time for each index.
+// Seeds are scrambled by the SplitMix64 finaliser, as nearby seeds of xorshift start out alike
+func listingNoise(i int) noise {
+	z := uint64(i+1) * 0x9e3779b97f4a7c15
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return noise(z ^ (z >> 31))
+}
+
+var inputSamples = make(chan stereoPair, 2400) // soundcard input, up to 50ms (@ 48kHz)
+
+var (
+	oscSync   = make(chan int, 16)      // beat count of sync pulses, sent by oscOut
+	rootBeat  = make(chan int, 16)      // beat count of sync pulses, sent to followers by syncRoot
+	rootPulse = make(chan struct{}, 1) // sync pulses received from root by syncFollow
+	remote    = make(chan remoteControl, 1) // pitch and tempo set from tools/info.go, see readControl
+)
+
+var tablet struct { // see tabletRead
+	Pressure, // 0 to 1
+	TiltX, // -1 to 1
+	TiltY float64
+}
+
 var mouse = struct {
 	X, // -255 to 255
 	Y,
@@ -381,10 +498,14 @@ var mouse = struct {
 	Right,
 	Middle float64
 	mc bool
+	gain, // sensitivity, see `: mousegain`
+	base float64 // of exponential curve, see `: mousebase`
 }{
-	X:  1,
-	Y:  1,
-	mc: yes, // mouse curve: not=linear, yes=exponential
+	X:    1,
+	Y:    1,
+	mc:   yes, // mouse curve: not=linear, yes=exponential
+	gain: 1,
+	base: 10,
 }
 
 type disp struct { // indicates:
@@ -398,19 +519,30 @@ type disp struct { // indicates:
 	MouseY  float64       // mouse Y coordinate
 	Paused  bool          // sound engine is paused
 	Mute    []bool        // mutes of all listings
+	Level   []float64     // peak output level of each listing, updated every levelInterval
 	SR      float64       // current sample rate
 	GR      bool          // limiter is in effect
+	GRdb    float64       // greatest gain reduction by the master limiter in dB, updated every levelInterval
 	Sync    bool          // sync pulse sent
+	Beat    int           // count of sync pulses sent, for external tools
 	Verbose bool          // show unrolled functions - all operations
 	Format	int           // output bit depth
 	Channel string        // stereo/mono
+	Backend string        // sound output in use, OSS or null
+	Bypass  bool          // master limiter is bypassed
+	Exports []string      // signals shared between listings, highlighted in tools/listing.go
+	Device  string        // soundcard device file
+	Clipl   int           // index of listing most recently limited, see `ct`, -1 for none
+	AutoGain float64      // gain applied by `: autogain` in dB, updated every levelInterval
 }
 
 var display = disp{
-	Mode:   "off",
-	Info:   "clear",
-	MouseX: 1,
-	MouseY: 1,
+	Mode:    "off",
+	Info:    "clear",
+	MouseX:  1,
+	MouseY:  1,
+	Exports: []string{"pitch", "tempo", "grid", "sync"}, // daisy-chained by default
+	Clipl:   -1,
 }
 
 type wavs []struct {
@@ -442,43 +574,202 @@ type clear func(s string, i ...interface{}) int
 var (
 	writeLog bool
 	log *os.File
+	headless bool // no soundcard or mouse, see backendNull
+	duplex   bool // read soundcard input into inL and inR
+	oscAddr  string // host:port to send OSC /sync messages, see oscOut
+	syncHost string // root instance to follow, see syncFollow
+	tabletDevice string // evdev device of a graphics tablet, see tabletRead
+	isRoot   bool   // send sync pulses to followers, see syncRoot
+	offline  bool   // output waits for the sound engine rather than inserting silence, see Engine
+	staged   bool   // listings launched while paused don't resume play, see --paused
+	srArg    string // sample rate given by --sr, see checkFlag
+	mono     bool   // open the soundcard as mono, output is the sum of left and right
+	quad     bool   // open the soundcard with four channels, see `depth`
+	device   = defaultDevice // soundcard to open, see ossDevice
+	maxRecordings int // oldest listing recordings beyond this are removed at start, unless zero
+	wavDir   = "wavs" // read by decodeWavs at start
 )
 
 func main() {
-	if len(os.Args) < 2 {
-		run(os.Stdin)
-		return
-	}
-	switch os.Args[1] {
-	case "--log", "-l":
-		var err error
-		log, err = os.OpenFile("info.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-		if err != nil {
-			pf("unable to log: %s", err)
+	if len(os.Args) > 1 && os.Args[1] == "--dir" { // first, so that the flags below use the directory
+		if len(os.Args) < 3 {
+			p("--dir requires a path")
 			return
 		}
-		defer log.Close()
-		_, err = log.WriteString(sf("\n-- Syntə info log %s --\n", time.Now()))
-		if err != nil {
-			pf("unable to log: %s", err)
+		if !workIn(os.Args[2]) {
 			return
 		}
-		writeLog = true
-		p("logging...")
-	case "-prof", "-p":
-		f, rr := os.Create("cpu.prof")
-		if e(rr) {
-			pf("no cpu profile: %v", rr)
+		os.Args = append(os.Args[:1], os.Args[3:]...)
+	}
+	args := os.Args[1:]
+	value := func() (string, bool) { // operand of a flag, taken from args
+		if len(args) < 2 || strings.HasPrefix(args[1], "-") {
+			return "", not
 		}
-		defer f.Close()
-		if rr := pprof.StartCPUProfile(f); e(rr) {
-			pf("profiling not started: %v", rr)
+		args = args[1:]
+		return args[0], yes
+	}
+	for ; len(args) > 0; args = args[1:] {
+		switch args[0] {
+		case "--log", "-l":
+			if !openLog() {
+				return
+			}
+			defer log.Close()
+			writeLog = true
+			p("logging...")
+		case "--events", "-e": // clip and overload only
+			if !openLog() {
+				return
+			}
+			defer log.Close()
+			p("logging clip and overload events...")
+		case "--paused":
+			display.Paused, staged = yes, yes
+			p("paused, listings are launched silently until `: play`")
+		case "--null", "-n":
+			headless = yes
+			p("running headless, no audio output")
+		case "--quad", "-4":
+			quad = yes
+			p("quad output")
+		case "--mono", "-m":
+			mono = yes
+			p("mono output")
+		case "--input", "-i":
+			duplex = yes
+			p("soundcard input enabled")
+		case "--osc-out", "-o":
+			v, ok := value()
+			if !ok {
+				p("--osc-out requires host:port")
+				return
+			}
+			oscAddr = v
+			pf("sending OSC /sync to %s\n", oscAddr)
+		case "--device", "-d":
+			v, ok := value()
+			if !ok {
+				p("--device requires a name or index, see --list-devices")
+				return
+			}
+			device = ossDevice(v)
+			pf("soundcard %s\n", device)
+		case "--list-devices":
+			listDevices()
+			return
+		case "--max-recordings":
+			maxRecordings = defaultMaxRecordings
+			if v, ok := value(); ok {
+				n, rr := strconv.Atoi(v)
+				if e(rr) || n < 1 {
+					p("--max-recordings requires a number greater than zero")
+					return
+				}
+				maxRecordings = n
+			}
+		case "--wavs", "-w":
+			v, ok := value()
+			if !ok {
+				p("--wavs requires a directory")
+				return
+			}
+			wavDir = v
+			pf("wavs from %s\n", wavDir)
+		case "--tanh-bits":
+			v, ok := value()
+			if !ok {
+				p("--tanh-bits requires a number")
+				return
+			}
+			n, rr := strconv.Atoi(v)
+			if e(rr) || n < minTanhBits || n > maxTanhBits {
+				pf("--tanh-bits requires a number from %d to %d\n", minTanhBits, maxTanhBits)
+				return
+			}
+			calcTanhTab(n)
+			pf("tanh table of %dKB\n", len(tanhTab)*8>>10)
+		case "--tablet", "-t":
+			v, ok := value()
+			if !ok {
+				p("--tablet requires a device, eg. /dev/input/event5")
+				return
+			}
+			tabletDevice = v
+			pf("reading tablet %s\n", tabletDevice)
+		case "--sr", "--SR", "-s":
+			v, ok := value()
+			if !ok {
+				p("--sr requires a sample rate, eg. 48 or 44100")
+				return
+			}
+			srArg = v
+		case "--sync-root":
+			isRoot = yes
+			pf("sync root on port %s\n", syncPort)
+		case "--sync-to":
+			v, ok := value()
+			if !ok {
+				p("--sync-to requires host")
+				return
+			}
+			syncHost = v
+			pf("following sync root at %s\n", syncHost)
+		case "-prof", "-p":
+			f, rr := os.Create("cpu.prof")
+			if e(rr) {
+				pf("no cpu profile: %v", rr)
+			}
+			defer f.Close()
+			if rr := pprof.StartCPUProfile(f); e(rr) {
+				pf("profiling not started: %v", rr)
+			}
+			defer pprof.StopCPUProfile() //*/
+		default:
+			pf("unknown flag %s\n", args[0])
+			return
 		}
-		defer pprof.StopCPUProfile() //*/
+	}
+	if mono && quad {
+		p("--mono and --quad can't be combined")
+		return
 	}
 	run(os.Stdin)
 }
 
+// workIn makes dir the working directory, so that all files are read and written there and
+// several instances may run in isolation, each with the tools run from its own directory
+func workIn(dir string) bool {
+	for _, d := range []string{dir, dir + "/" + tempDir, dir + "/recordings"} {
+		if rr := os.MkdirAll(d, 0755); e(rr) {
+			pf("unable to make '%s': %v\n", d, rr)
+			return not
+		}
+	}
+	if rr := os.Chdir(dir); e(rr) {
+		pf("unable to change to '%s': %v\n", dir, rr)
+		return not
+	}
+	pf("working in %s\n", dir)
+	return yes
+}
+
+func openLog() bool {
+	var err error
+	log, err = os.OpenFile("info.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		pf("unable to log: %s", err)
+		return false
+	}
+	_, err = log.WriteString(sf("\n-- Syntə info log %s --\n", time.Now()))
+	if err != nil {
+		pf("unable to log: %s", err)
+		log.Close()
+		return false
+	}
+	return true
+}
+
 const advisory = `
 Protect your hearing when listening to any audio on a system capable of
 more than 85dB SPL
@@ -502,26 +793,62 @@ func emptyTokens() {
 }
 
 func run(from io.Reader) {
+	if maxRecordings > 0 {
+		if n := pruneRecordings("./recordings/", maxRecordings); n > 0 {
+			pf("%d oldest listing recordings removed, %d kept\n", n, maxRecordings)
+		}
+	}
 	saveJson([]listing{{operation{Op: advisory}}}, "displaylisting.json")
 	go infoDisplay()
 
-	sc, success := setupSoundCard("/dev/dsp")
+	var sc soundcard
+	success := not
+	switch {
+	case headless:
+		sc, success = setupNull()
+	default:
+		sc, success = setupSoundCard(device)
+		if success {
+			sc.file = &reconnector{sc: sc, device: device}
+		}
+	}
 	if !success {
-		p("unable to setup soundcard")
-		sc.file.Close()
+		noSoundcard(device)
+		if sc.file != nil {
+			sc.file.Close()
+		}
 		return
 	}
 	defer sc.file.Close()
 	if writeLog {
+		go logPrinted()
 		log.WriteString(sf("soundcard: %dbit %2gkHz %s\n", sc.format, sc.sampleRate, sc.channels))
 	}
 	SampleRate = sc.sampleRate // TODO remove later
-	t, twavs, wavSlice := newSystemState(sc)
+	calcSineTab(SampleRate)
+	t, twavs, _ := newSystemState(sc)
 
 	go SoundEngine(sc, twavs)
-	go mouseRead()
+	if !headless {
+		go mouseRead()
+	}
+	if tabletDevice != "" {
+		go tabletRead(tabletDevice)
+	}
+	if duplex && !headless {
+		go soundcardRead(sc)
+	}
+	if oscAddr != "" {
+		go oscOut(oscAddr)
+	}
+	if isRoot {
+		go syncRoot()
+	}
+	if syncHost != "" {
+		go syncFollow(syncHost)
+	}
 
-	// TODO add sc, twavs as args to watchdog, they don't mutate
+	// TODO add sc as arg to watchdog, it doesn't mutate
 	go func() { // watchdog, anonymous to use variable in scope: dispListings
 		// This function will restart the sound engine in the event of a panic
 		for {
@@ -531,7 +858,7 @@ func run(from io.Reader) {
 				return
 			}
 			stop = make(chan struct{})
-			go SoundEngine(sc, twavs)
+			go SoundEngine(sc, wavData(t.wavSlice))
 			lockLoad <- struct{}{}
 			emptyTokens()
 			tokens <- token{"_", -1, yes}              // hack to restart input
@@ -555,19 +882,30 @@ func run(from io.Reader) {
 
 	go readInput(from) // scan stdin from goroutine to allow external concurrent input
 	go reloadListing() // poll '.temp/*.syt' modified time and reload if changed
+	go readControl()   // poll 'control.json' for pitch and tempo sent by tools/info.go
 
+	loadPrefs()
 	usage := loadUsage() // local usage telemetry
+	t.usage = usage
+
+	go func() { // Ctrl-C exits through the main loop, as `: exit` does
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		<-sig
+		signal.Stop(sig) // so a second Ctrl-C ends immediately
+		select {
+		case cancelWait <- struct{}{}: // interrupt a wait in progress
+		default:
+		}
+		tokens <- token{"_", -1, not} // abandon an operation in progress
+		tokens <- token{":exit", -1, not}
+	}()
 	loadExternalFile := not // TODO move this to listingState
 
 start:
 	for { // main loop
 		t = initialiseListing(t)
-		for i, w := range wavSlice {
-			t.createListing = addSignal(t.createListing, w.Name, float64(i))
-			rate := 1.0 / float64(len(w.Data))
-			name := "r."+w.Name
-			t.createListing = addSignal(t.createListing, name, rate)
-		}
+		t.createListing = addWavSignals(t.createListing, t.wavSlice)
 		// the purpose of clr is to reset the input if error while receiving tokens from external source, declared in this scope to read value of loadExternalFile
 		t.clr = func(s string, i ...interface{}) int {
 			emptyTokens()
@@ -582,141 +920,27 @@ start:
 			displayHeader()
 		}
 
-	input:
-		for { // input loop
-			t.newOperation = newOperation{}
-			if !loadExternalFile {
-				pf("\r\t")
-			}
-			var do int
-			t, loadExternalFile, do = parseNewOperation(t)
-			switch do {
-			case startNewListing:
-				loadExternalFile = not
-			//	emptyTokens()
-				continue start
-			case startNewOperation:
-				if loadExternalFile {
-					loadExternalFile = not
-					emptyTokens()
-					continue start
-				}
-				continue input
-			case exitNow:
-				break start
-			}
-			usage[t.operator] += 1
-
-			// process exported signals
-			// TODO make this a function and add to parseFunction too
-			if _, inSg := t.signals[t.operand]; !inSg &&
-			isUppercaseInitial(t.operand) &&
-			!t.num.Is && !t.fIn &&
-			t.operator != "//" { // optional: && t.operator == "out"
-				if t.lenExported > maxExports {
-					msg("we've ran out of exported signals :(")
-					continue
-				}
-				if _, exported := t.exportedSignals[t.operand]; !exported {
-					t.exportedSignals[t.operand] = lenReserved + t.lenExported
-					t.daisyChains = append(t.daisyChains, lenReserved+t.lenExported)
-					t.lenExported++
-					msg("%s%s added to exported signals%s", t.operand, italic, reset)
-				}
-				t.signals[t.operand] = t.exportedSignals[t.operand]
-			}
-			o := operation{Op: t.operator, Opd: t.operand, num: t.num.Is, ber: t.num.Ber}
-			t.dispListing = append(t.dispListing, o)
-			if !t.isFunction { // contents of function have been added already
-				t.newListing = append(t.newListing, o)
-			}
-			if t.fIn {
-				continue
-			}
-			// include contents of a function
-			switch o := t.newListing[len(t.newListing)-1]; o.Op {
-			case "out":
-				if o.Opd == "dac" {
-					break input
-				}
-			case ".out", ".>sync", ".level", ".lvl", ".pan", "//", "deleted":
-				break input
-			}
-			if !loadExternalFile {
-				msg(" ")
-			}
+		var do int
+		t, do = inputListing(t, &loadExternalFile, usage)
+		switch do {
+		case startNewListing:
+			continue start
+		case exitNow:
+			break start
 		}
 
-		for _, o := range t.newListing {
-			infoIfLogging("assign: num=%t,%f -> %s %s", o.num, o.ber, o.Op, o.Opd)
-			if _, in := t.signals[o.Opd]; in {
-				continue
-			}
-			if o.Opd == "" {
-				t.signals[o.Opd] = 1
-				continue
-			}
-			if o.num {
-				t.createListing = addSignal(t.createListing, o.Opd, o.ber)
-				infoIfLogging("  num: %s at %d -> %f", o.Opd, len(t.newSignals)-1, o.ber)
-				continue
-			}
-			def := 0.0
-			switch strings.TrimPrefix(o.Opd, "^")[:1] {
-			case "'":
-				def = 1
-			case "\"":
-				def = 0.5
-			}
-			t.createListing = addSignal(t.createListing, o.Opd, def)
-			infoIfLogging("  sig: %s at %d, def: %2.1f", o.Opd, len(t.newSignals)-1, def)
-		}
-
-		if t.reload > -1 && t.reload < len(t.verbose) {
-			for l, o := range t.newListing {
-				for _, v := range t.verbose[t.reload] {
-					if o.num || o.Opd != v.Opd || o.Opd == "" {
-						continue
-					}
-					t.newListing[l].P = yes // persist signal
-					t.newListing[l].i = v.N
-				}
-			}
-		}
-
-		for i, o := range t.newListing {
-			t.newListing[i].N = t.signals[o.Opd]
-			s := t.signals[o.Opd]
-			infoIfLogging("adding: %s at %d -> %f", o.Opd, s, t.newSignals[s])
-			t.newListing[i].Opn = operators[o.Op].N
-		}
+		t = compileListing(t)
 
-		if display.Paused {
+		if display.Paused && !staged {
 			<-pause
 			display.Paused = not
 		}
 
-		lockLoad <- struct{}{}
-		if !started { // anull/truncate these in case sound engine restarted
-			t.dispListings = make([]listing, 0, 15) // arbitrary capacity
-			t.verbose = make([]listing, 0, 15)
-		}
-		transmit <- collate(&t)
-		a := <-accepted
-		if a != len(t.dispListings) {
-			infoIfLogging("len(mutes): %d, len(disp): %d, accepted: %d", len(mutes), len(t.dispListings), a)
-			time.Sleep(200 * time.Millisecond)
-		}
-		<-lockLoad
-
-		if !started {
-			display.On = yes
-			started = yes
-		}
+		t = launchListing(t)
 
 		timestamp := time.Now().Format("02-01-06.15:04")
 		f := "recordings/listing." + timestamp + ".json"
-		if !saveJson(t.newListing, f) {
+		if !saveJson(recording{Version: saveVersion, Listing: t.newListing}, f) {
 			msg("%slisting not recorded, check 'recordings/' directory exists%s", italic, reset)
 		}
 		display.Verbose = not
@@ -731,6 +955,351 @@ start:
 	saveUsage(usage, t)
 }
 
+// shutdown stops the sound engine and saves state, for `: exit` and Ctrl-C
+func shutdown(s systemState) {
+	p("\nexiting...")
+	exit = yes
+	display.Beat = 0
+	if display.Paused && started {
+		<-pause
+	}
+	if started {
+		<-stop // received when shutdown complete
+	} else {
+		close(stop)
+	}
+	saveJson([]listing{{operation{Op: advisory}}}, "displaylisting.json")
+	p("Stopped")
+	if s.funcsave && !saveFunctions(s.funcs) {
+		msg("functions not saved!")
+	}
+	time.Sleep(30 * time.Millisecond) // wait for infoDisplay to finish
+}
+
+// stressListing is representative, an oscillator and filter. Silent, but processed unlike a muted listing
+const stressListing = "in 110hz, + a, mod 1, out a, sine, sub b, mul 0.1, + b, out b, mul 0, out dac"
+
+const (
+	maxStress  = 500
+	stressTime = 3 * time.Second // more than RateIntegrationTime, for the load to settle
+)
+
+// stressTest launches n copies of stressListing and reports the load, before removing them.
+// For finding how many listings can be run safely
+func stressTest(s systemState) (systemState, int) {
+	a, ok := modeArg()
+	n, rr := strconv.Atoi(a)
+	if !ok || e(rr) || n < 1 || n > maxStress {
+		msg("%sstress requires a number of listings, up to%s %d", italic, reset, maxStress)
+		return s, startNewOperation
+	}
+	if !started || display.Paused || len(s.newListing) > 0 {
+		msg("%sstress requires playing listings and an empty input%s", italic, reset)
+		return s, startNewOperation
+	}
+	before, u := loadRatio(), underruns
+	t := s
+	t.ephemeral = yes // not saved to tempDir
+	l := len(t.dispListings)
+	for i := 0; i < n; i++ {
+		tt, rr := launchSource(t, stressListing, nil, map[string]int{}) // not counted in usage
+		if e(rr) {
+			msg("%v", rr)
+			break
+		}
+		t = tt
+	}
+	added := len(t.dispListings) - l
+	msg("%s%d listings added, waiting...%s", italic, added, reset)
+	time.Sleep(stressTime)
+	after, u := loadRatio(), underruns-u
+	index := make([]int, len(t.dispListings))
+	for i := range index {
+		index[i] = i
+		if i >= l {
+			index[i] = -1
+		}
+	}
+	t, _ = removeListings(t, index, l)
+	t.ephemeral, t.listingState = s.ephemeral, s.listingState
+	msg("%sload with %d more listings:%s %.2f%s, was %.2f, %d samples underrun%s",
+		italic, added, reset, after, italic, before, u, reset)
+	if after > 0.9 {
+		msg("%snear overload, fewer listings are safe%s", italic, reset)
+	}
+	return t, startNewOperation
+}
+
+// launchSource is launchFromSource, assigned in init as that refers to operators,
+// which refers to stressTest by way of modeSet
+var launchSource func(systemState, string, wavs, map[string]int) (systemState, error)
+
+// loadRatio is the time taken to calculate a sample relative to the sample period, overload above 1
+func loadRatio() float64 {
+	return float64(display.Load) * SampleRate / 1e9
+}
+
+// Engine is a test harness that runs Syntə without a soundcard, rendering samples on demand. Eg.
+//
+//	eng := New(48000)
+//	eng.Launch("in 330hz osc sine mix")
+//	buf := eng.Render(48000)
+//
+// It is not embeddable, being in package main, and drives the same globals as run()
+// (tokens, transmit, mutes, levels, display, SampleRate), so only one Engine may run at a time, and not alongside run()
+type Engine struct {
+	t        systemState
+	wavSlice wavs
+	r        *io.PipeReader
+	usage    map[string]int
+	done     chan struct{}
+}
+
+// New starts a sound engine that waits on Render for output
+func New(sampleRate float64) *Engine {
+	r, w := io.Pipe()
+	sc := soundcard{
+		file:       w,
+		channels:   "stereo",
+		sampleRate: sampleRate,
+		format:     16,
+		convFactor: math.MaxInt16,
+	}
+	SampleRate = sampleRate
+	calcSineTab(SampleRate)
+	exit, started, offline = not, not, yes
+	stop = make(chan struct{})
+	mutes, levels, bypassed, display.Mute = nil, nil, nil, nil
+	display.Beat = 0
+	t, twavs, wavSlice := newSystemState(sc)
+	t.ephemeral = yes
+	eng := &Engine{t: t, wavSlice: wavSlice, r: r, usage: map[string]int{}, done: make(chan struct{})}
+	eng.t.usage = eng.usage
+	go func() { // stands in for infoDisplay and the watchdog
+		for {
+			select {
+			case <-info:
+			case carryOn <- yes:
+			case <-report: // sound engine has panicked
+			case <-eng.done:
+				return
+			}
+		}
+	}()
+	go func() {
+		SoundEngine(sc, twavs)
+		w.Close() // Render returns early if sound engine stops
+	}()
+	return eng
+}
+
+// Launch compiles a listing from source and sends it to the sound engine.
+// It doesn't wait on Render, the listing is received while output is held
+func (eng *Engine) Launch(src string) error {
+	t, rr := launchFromSource(eng.t, src, eng.wavSlice, eng.usage)
+	if rr != nil {
+		return rr
+	}
+	eng.t = t
+	return nil
+}
+
+// launchFromSource compiles a listing from source and sends it to the sound engine, for Engine
+// and `: stress`. Tokens already input are discarded
+func launchFromSource(t systemState, src string, wavSlice wavs, usage map[string]int) (systemState, error) {
+	t = initialiseListing(t)
+	t.createListing = addWavSignals(t.createListing, wavSlice)
+	var rr error
+	t.clr = func(s string, i ...interface{}) int {
+		rr = fmt.Errorf(s, i...)
+		return startNewListing
+	}
+	fields := strings.Fields(src)
+	if !tokenSpace(len(fields) + 1) { // would block, as tokens are read below
+		return t, fmt.Errorf("listing too long: %d tokens", len(fields))
+	}
+	for _, tk := range fields {
+		tokens <- token{tk, -1, yes}
+	}
+	tokens <- token{"_", -1, yes} // ends input if listing is incomplete
+	ldExt := yes
+	t, do := inputListing(t, &ldExt, usage)
+	emptyTokens()
+	if do != nextOperation {
+		if rr == nil {
+			rr = fmt.Errorf("listing not accepted: %s", src)
+		}
+		return t, rr
+	}
+	return launchListing(compileListing(t)), nil
+}
+
+// Render returns n stereo samples interleaved left then right, in range [-1, 1]
+// Fewer samples are returned if the sound engine has stopped
+func (eng *Engine) Render(n int) []float64 {
+	if !started {
+		return make([]float64, 2*n) // nothing launched yet
+	}
+	b := make([]byte, 4*n) // 16bit stereo
+	c, _ := io.ReadFull(eng.r, b)
+	buf := make([]float64, c/2)
+	for i := range buf {
+		buf[i] = float64(int16(uint16(b[2*i])|uint16(b[2*i+1])<<8)) / math.MaxInt16
+	}
+	return buf
+}
+
+// Close fades out and stops the sound engine
+func (eng *Engine) Close() {
+	exit = yes
+	eng.r.Close() // unblock output
+	if started {
+		<-stop
+	}
+	close(eng.done)
+}
+
+// compileListing assigns signals to the operations of a completed listing
+func compileListing(t systemState) systemState {
+	for _, o := range t.newListing {
+		infoIfLogging("assign: num=%t,%f -> %s %s", o.num, o.ber, o.Op, o.Opd)
+		if _, in := t.signals[o.Opd]; in {
+			continue
+		}
+		if o.Opd == "" {
+			t.signals[o.Opd] = 1
+			continue
+		}
+		if o.num {
+			t.createListing = addSignal(t.createListing, o.Opd, o.ber)
+			infoIfLogging("  num: %s at %d -> %f", o.Opd, len(t.newSignals)-1, o.ber)
+			continue
+		}
+		def := 0.0
+		switch strings.TrimPrefix(o.Opd, "^")[:1] {
+		case "'":
+			def = 1
+		case "\"":
+			def = 0.5
+		}
+		t.createListing = addSignal(t.createListing, o.Opd, def)
+		infoIfLogging("  sig: %s at %d, def: %2.1f", o.Opd, len(t.newSignals)-1, def)
+	}
+
+	if t.reload > -1 && t.reload < len(t.verbose) {
+		for l, o := range t.newListing {
+			for _, v := range t.verbose[t.reload] {
+				if o.num || o.Opd != v.Opd || o.Opd == "" {
+					continue
+				}
+				t.newListing[l].P = yes // persist signal
+				t.newListing[l].i = v.N
+			}
+		}
+	}
+
+	for i, o := range t.newListing {
+		t.newListing[i].N = t.signals[o.Opd]
+		s := t.signals[o.Opd]
+		infoIfLogging("adding: %s at %d -> %f", o.Opd, s, t.newSignals[s])
+		t.newListing[i].Opn = operators[o.Op].N
+	}
+	return t
+}
+
+// launchListing transfers a compiled listing to the sound engine
+func launchListing(t systemState) systemState {
+	lockLoad <- struct{}{}
+	if !started { // anull/truncate these in case sound engine restarted
+		t.dispListings = make([]listing, 0, 15) // arbitrary capacity
+		t.verbose = make([]listing, 0, 15)
+	}
+	transmit <- collate(&t)
+	a := <-accepted
+	if a != len(t.dispListings) {
+		infoIfLogging("len(mutes): %d, len(disp): %d, accepted: %d", len(mutes), len(t.dispListings), a)
+		time.Sleep(200 * time.Millisecond)
+	}
+	<-lockLoad
+
+	if !started {
+		display.On = yes
+		started = yes
+	}
+	return t
+}
+
+// inputListing parses operations until a listing is complete, returning nextOperation.
+// Otherwise startNewListing or exitNow is returned to the main loop
+func inputListing(t systemState, ldExt *bool, usage map[string]int) (systemState, int) {
+	for { // input loop
+		t.newOperation = newOperation{}
+		if !*ldExt {
+			pf("\r\t")
+		}
+		var do int
+		mark := len(t.newListing)
+		t, *ldExt, do = parseNewOperation(t)
+		switch do {
+		case startNewListing:
+			*ldExt = not
+		//	emptyTokens()
+			return t, startNewListing
+		case startNewOperation:
+			if *ldExt {
+				*ldExt = not
+				emptyTokens()
+				return t, startNewListing
+			}
+			continue
+		case exitNow:
+			return t, exitNow
+		}
+		usage[t.operator] += 1
+
+		// process exported signals
+		// TODO make this a function and add to parseFunction too
+		if _, inSg := t.signals[t.operand]; !inSg &&
+		isUppercaseInitial(t.operand) &&
+		!t.num.Is && !t.fIn &&
+		t.operator != "//" { // optional: && t.operator == "out"
+			if t.lenExported > maxExports {
+				msg("we've ran out of exported signals :(")
+				continue
+			}
+			if _, exported := t.exportedSignals[t.operand]; !exported {
+				t.exportedSignals[t.operand] = lenReserved + t.lenExported
+				t.daisyChains = append(t.daisyChains, lenReserved+t.lenExported)
+				t.lenExported++
+				msg("%s%s added to exported signals%s", t.operand, italic, reset)
+				display.Exports = append(display.Exports, t.operand)
+			}
+			t.signals[t.operand] = t.exportedSignals[t.operand]
+		}
+		o := operation{Op: t.operator, Opd: t.operand, num: t.num.Is, ber: t.num.Ber}
+		t.dispListing = append(t.dispListing, o)
+		t.marks = append(t.marks, mark)
+		if !t.isFunction { // contents of function have been added already
+			t.newListing = append(t.newListing, o)
+		}
+		if t.fIn {
+			continue
+		}
+		// include contents of a function
+		switch o := t.newListing[len(t.newListing)-1]; o.Op {
+		case "out":
+			if o.Opd == "dac" {
+				return t, nextOperation
+			}
+		case ".out", ".>sync", ".level", ".lvl", ".pan", ".depth", "//", "deleted":
+			return t, nextOperation
+		}
+		if !*ldExt {
+			msg(" ")
+		}
+	}
+}
+
 func parseNewOperation(t systemState) (systemState, bool, int) {
 	ldExt, result := readTokenPair(&t)
 	if result != nextOperation {
@@ -765,7 +1334,14 @@ func addIfFunction(t systemState) (systemState, int) {
 	if !ok {
 		return t, startNewOperation
 	}
-	t.funCount++
+	seen := map[string]bool{}
+	for _, o := range append(t.newListing, function...) { // function bodies aren't checked by operator
+		if seen[o.Op] && oneEach[o.Op] {
+			msg("%s: %sonly one %s per listing%s", t.operator, italic, o.Op, reset)
+			return t, startNewOperation
+		}
+		seen[o.Op] = yes
+	}
 	t.newListing = append(t.newListing, function...)
 	return t, nextOperation
 }
@@ -784,6 +1360,22 @@ func loadNewListing(listing []operation) []opSE {
 	return l
 }
 
+// sendsToListings reports whether a listing has an effect beyond its own output,
+// such a listing is not skipped when muted
+func sendsToListings(l listing) bool {
+	for _, o := range l {
+		switch o.Op {
+		case "out", ".out", "out+", "out-":
+			if o.Opd != "dac" && isUppercaseInitialOrDefaultExported(o.Opd) {
+				return yes
+			}
+		case ">sync", ".>sync", "level", ".level", "lvl", ".lvl", "pan", ".pan", "depth", ".depth", "print", "halt", "panic":
+			return yes
+		}
+	}
+	return not
+}
+
 func collate(t *systemState) *data {
 	safe := t.newSignals
 	if t.newListing[0].Op == "deleted" {
@@ -796,13 +1388,31 @@ func collate(t *systemState) *data {
 			listing: loadNewListing(t.newListing),
 			lv:       1,
 			peakfreq: 800 / t.sampleRate,
-			buff:     make([]float64, t.tapeLen),
+			buff:     buffLoops(t.newListing, t.tapeLen),
+			cmp: compressor{
+				ratio: 4,
+				att:   1 / (5e-3 * t.sampleRate),
+				rel:   1 / (200e-3 * t.sampleRate),
+			},
+			pk: biquad{g: 1, q: 0.707},
+			eu: euclidean{steps: 8},
+			hop: N / overlap,
+			pstack: make([]float64, 0, maxPersistStack),
 			sigs:    safe,
+			sends:   sendsToListings(t.newListing),
 		},
 	}
+	for _, o := range t.newListing {
+		if o.Op != "seq" {
+			continue
+		}
+		if v, ok := parseSeq(o.Opd); ok {
+			d.sq.vals, d.sq.v = v, v[0]
+		}
+	}
 	m := 1.0
 	switch o := t.newListing[len(t.newListing)-1]; o.Op {
-	case ".out", ".>sync", ".level", ".lvl", ".pan", "deleted": // silent listings
+	case ".out", ".>sync", ".level", ".lvl", ".pan", ".depth", "deleted": // silent listings
 		m = 0 // to display as muted
 	}
 	if t.reload > -1 && t.reload < len(t.dispListings) {
@@ -822,8 +1432,11 @@ func collate(t *systemState) *data {
 	display.Mute = append(display.Mute, (m == 0))
 	mutes = append(mutes, m)
 	levels = append(levels, 1)
+	bypassed = append(bypassed, not)
 	t.unsolo = append(t.unsolo, m)
-	saveTempFile(*t, len(mutes)-1) // second argument sets name of file
+	if !t.ephemeral {
+		saveTempFile(*t, len(mutes)-1) // second argument sets name of file
+	}
 	return d
 }
 
@@ -846,19 +1459,102 @@ func (m *muteSlice) set(i int, v float64) {
 }
 
 type soundcard struct {
-	file       *os.File
+	file       io.WriteCloser
 	channels   string
 	sampleRate float64
 	format     int
 	convFactor float64
 }
 
+// checkFlag returns the sample rate requested by `--sr`, otherwise sr. Used by every backend
+func checkFlag(sr uint32) uint32 {
+	if srArg == "" {
+		return sr
+	}
+	r, ok := parseSampleRate(srArg)
+	if !ok {
+		pf("sample rate %s not accepted, using %dHz\n", srArg, sr)
+		return sr
+	}
+	return r
+}
+
+// parseSampleRate accepts Hz, eg. 48000, or kHz, eg. 44.1, 48, 96 or 192. 44 is taken as 44.1
+func parseSampleRate(a string) (uint32, bool) {
+	f, rr := strconv.ParseFloat(a, 64)
+	if e(rr) {
+		return 0, not
+	}
+	if f < 1000 { // kHz
+		f = math.Round(f * 1000)
+	}
+	if f == 44000 {
+		f = 44100
+	}
+	if f < 12000 || f > 192000 || f != math.Trunc(f) {
+		return 0, not
+	}
+	return uint32(f), yes
+}
+
+// backendNull discards all output, for running without a soundcard eg. automated testing
+// No timing is imposed so the sound engine will run as fast as it can
+type backendNull struct{}
+
+func (backendNull) Write(b []byte) (int, error) { return len(b), nil }
+func (backendNull) Close() error                { return nil }
+
+func setupNull() (soundcard, bool) {
+	sc := soundcard{
+		file:       backendNull{},
+		channels:   "stereo",
+		sampleRate: float64(checkFlag(SAMPLE_RATE)),
+		format:     16,
+		convFactor: math.MaxInt16,
+	}
+	display.SR = sc.sampleRate
+	display.Format = sc.format
+	display.Channel = sc.channels
+	display.Backend = "null"
+	display.Device = ""
+	return sc, yes
+}
+
+const maxTokenLength = 256 // longer tokens are rejected, most likely pasted by mistake
+
+// tokenSpace reports whether n tokens can be sent without blocking, for senders on the main loop
+func tokenSpace(n int) bool {
+	return n <= cap(tokens)-len(tokens)
+}
+
+// validName reports whether s is a name as given in the grammar at the top of this file.
+// The "." is allowed after the first letter as it is used to number signals in functions
+func validName(s string) bool {
+	for i, r := range s {
+		switch {
+		case r == '+' || r == '-':
+			return not
+		case i == 0 && (r == '.' || r >= '0' && r <= '9'):
+			return not
+		}
+	}
+	return s != ""
+}
+
 func readTokenPair(t *systemState) (bool, int) {
 	tt := <-tokens
 	t.operator, t.reload = tt.tk, tt.reload
+	if len(t.operator) > maxTokenLength {
+		r := t.clr("%stoken too long:%s %.16s...", italic, reset, t.operator)
+		return tt.ext, r
+	}
 	if (len(t.operator) > 2 && byte(t.operator[1]) == 91) || t.operator == "_" || t.operator == "" {
 		return tt.ext, startNewOperation
 	}
+	if t.operator == "<<" {
+		undoOperation(t)
+		return tt.ext, startNewOperation
+	}
 	t.operator = strings.TrimSuffix(t.operator, ",")  // to allow comma separation of tokens
 	if len(t.operator) > 1 && t.operator[:1] == ":" { // hacky shorthand
 		t.operand = t.operator[1:]
@@ -867,6 +1563,11 @@ func readTokenPair(t *systemState) (bool, int) {
 	}
 	hO, in := t.hasOperand[t.operator]
 	if !in {
+		if s := suggest(t.operator, t.hasOperand); len(s) > 0 {
+			r := t.clr("%soperator or function doesn't exist:%s %s, %sdid you mean%s %s?",
+				italic, reset, t.operator, italic, reset, strings.Join(s, " or "))
+			return tt.ext, r
+		}
 		r := t.clr("%soperator or function doesn't exist:%s %s", italic, reset, t.operator)
 		return tt.ext, r
 	}
@@ -878,6 +1579,10 @@ func readTokenPair(t *systemState) (bool, int) {
 	// parse second token
 	tt = <-tokens
 	t.operand, t.reload = tt.tk, tt.reload
+	if len(t.operand) > maxTokenLength {
+		r := t.clr("%stoken too long:%s %.16s...", italic, reset, t.operand)
+		return tt.ext, r
+	}
 	t.operand = strings.TrimSuffix(t.operand, ",") // to allow comma separation of tokens
 	if t.operand == "_" || t.operand == "" {
 		return tt.ext, startNewOperation
@@ -885,19 +1590,30 @@ func readTokenPair(t *systemState) (bool, int) {
 	s := strings.ReplaceAll(t.operand, "{i}", "0")
 	s = strings.ReplaceAll(s, "{i+1}", "0")
 	t.operands = strings.Split(s, ",")
-	if !t.isFunction && len(t.operands) > 1 {
+	if !t.isFunction && len(t.operands) > 1 && t.operator != "seq" {
 		r := t.clr("only functions can have multiple operands")
 		return tt.ext, r
 	}
 	pass := t.wmap[t.operand] && t.operator == "wav"
-	switch t.operator { // operand can start with a number
-	case "ls", "load", "//":
+	switch t.operator { // operand can start with a number or is a file path
+	case "ls", "load", "ld", "record", "//", "erase", "e", "seq": // erase may be followed by an operator, seq takes a list
 		pass = true
 	}
-	if !strings.ContainsAny(s[:1], "+-.0123456789") || pass || t.isFunction {
+	if pass || t.isFunction {
+		return tt.ext, nextOperation
+	}
+	if !strings.ContainsAny(s[:1], "+-.0123456789") {
+		if !validName(s) {
+			r := t.clr("%snot a valid name:%s %s, %snames can't contain + or -%s",
+				italic, reset, t.operand, italic, reset)
+			return tt.ext, r
+		}
 		return tt.ext, nextOperation
 	}
 	if t.num.Ber, t.num.Is = parseType(s, t.operator); !t.num.Is {
+		if unicode.IsDigit(rune(s[0])) && validName("_"+s) && strings.IndexFunc(s, unicode.IsLetter) > -1 {
+			msg("%snames can't begin with a digit:%s %s", italic, reset, t.operand)
+		}
 		r := t.clr("")
 		return tt.ext, r // parseType will report error
 	}
@@ -905,17 +1621,159 @@ func readTokenPair(t *systemState) (bool, int) {
 	return tt.ext, nextOperation
 }
 
-type args struct{ at, at1, at2 bool }
+// oscOut sends an OSC message `/sync` with the beat count as argument for each sync pulse.
+// UDP is connectionless, so errors from an unreachable address are ignored
+func oscOut(addr string) {
+	conn, rr := net.Dial("udp", addr)
+	if e(rr) {
+		msg("OSC out unavailable: %v", rr)
+		return
+	}
+	defer conn.Close()
+	for b := range oscSync {
+		conn.Write(oscMessage("/sync", int32(b))) // errors ignored
+	}
+}
+
+const syncPort = "57300" // UDP port of sync root
 
-func parseFunction(t systemState) (listing, bool) {
-	function := make(listing, len(t.funcs[t.operator].Body))
-	copy(function, t.funcs[t.operator].Body)
-	funArgs := args{}
-	funArgs, function = processFunction(t.funCount, t, function)
-	ok := argsCorrect(t.operator, funArgs, t.clr, len(t.operands))
-	if !ok {
-		return nil, not
+// syncRoot sends sync pulses to followers, which register by sending any packet to syncPort
+func syncRoot() {
+	conn, rr := net.ListenPacket("udp", ":"+syncPort)
+	if e(rr) {
+		msg("sync root unavailable: %v", rr)
+		return
+	}
+	defer conn.Close()
+	register := make(chan net.Addr, 8)
+	go func() {
+		b := make([]byte, 64)
+		for {
+			_, a, rr := conn.ReadFrom(b)
+			if e(rr) {
+				return
+			}
+			register <- a
+		}
+	}()
+	followers := map[string]net.Addr{}
+	for {
+		select {
+		case a := <-register:
+			if _, in := followers[a.String()]; !in {
+				msg("%s%s is following%s", italic, a, reset)
+			}
+			followers[a.String()] = a
+		case b := <-rootBeat:
+			m := oscMessage("/sync", int32(b))
+			for _, a := range followers {
+				conn.WriteTo(m, a) // errors ignored, follower may have gone
+			}
+		}
+	}
+}
+
+// syncFollow registers with the root at host every second and passes on its sync pulses to rootPulse
+func syncFollow(host string) {
+	conn, rr := net.Dial("udp", net.JoinHostPort(host, syncPort))
+	if e(rr) {
+		msg("unable to follow %s: %v", host, rr)
+		return
+	}
+	defer conn.Close()
+	go func() { // repeated in case root is restarted
+		for !exit {
+			conn.Write(oscMessage("/follow", 0)) // errors ignored
+			time.Sleep(time.Second)
+		}
+	}()
+	b := make([]byte, 64)
+	for !exit {
+		n, rr := conn.Read(b)
+		if e(rr) { // root unavailable
+			time.Sleep(time.Second)
+			continue
+		}
+		if n >= 5 && string(b[:5]) == "/sync" {
+			select {
+			case rootPulse <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// oscMessage encodes an OSC message with a single int32 argument
+func oscMessage(address string, arg int32) []byte {
+	pad := func(b []byte) []byte { // null terminate and pad to multiple of 4 bytes
+		return append(b, make([]byte, 4-len(b)%4)...)
 	}
+	m := pad([]byte(address))
+	m = append(m, pad([]byte(",i"))...)
+	return append(m, byte(arg>>24), byte(arg>>16), byte(arg>>8), byte(arg))
+}
+
+const maxSuggestions = 3
+
+// suggest returns up to maxSuggestions of the closest names to a mistyped operator
+func suggest(op string, names map[string]bool) []string {
+	type match struct {
+		name string
+		dist int
+	}
+	limit := len([]rune(op))/3 + 1 // beyond this the suggestion is more confusing than helpful
+	var m []match
+	for name := range names {
+		if d := levenshtein(op, name); d <= limit {
+			m = append(m, match{name, d})
+		}
+	}
+	sort.Slice(m, func(i, j int) bool {
+		if m[i].dist == m[j].dist {
+			return m[i].name < m[j].name
+		}
+		return m[i].dist < m[j].dist
+	})
+	s := make([]string, 0, maxSuggestions)
+	for i := 0; i < len(m) && i < maxSuggestions; i++ {
+		s = append(s, m[i].name)
+	}
+	return s
+}
+
+// levenshtein is the edit distance between a and b, counted in runes
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = prev[j-1] + cost
+			if prev[j]+1 < curr[j] {
+				curr[j] = prev[j] + 1
+			}
+			if curr[j-1]+1 < curr[j] {
+				curr[j] = curr[j-1] + 1
+			}
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+type args struct{ at, at1, at2, at3 bool }
+
+const maxFunctionDepth = 8 // nesting beyond this is assumed to be a cycle
+
+func parseFunction(t systemState) (listing, bool) {
 	for i, opd := range t.operands { // opd shadowed
 		if t.operands[i] == "" {
 			t.clr("%s: empty argument %d", t.operator, i+1)
@@ -928,49 +1786,111 @@ func parseFunction(t systemState) (listing, bool) {
 			return nil, not // parseType will report error
 		}
 	}
+	// signals are numbered by instance of this function, rather than position in the listing, so
+	// that an edit elsewhere doesn't rename them. They then persist on reload, eg. phase of `osc`
+	n := 0
+	for _, o := range t.dispListing {
+		if o.Op == t.operator {
+			n++
+		}
+	}
+	return expandFunction(t.operator, t.operands, sf(".%s.%d", t.operator, n), 0, t)
+}
+
+// expandFunction returns the body of function op with operands substituted for its arguments.
+// Functions within the body are expanded in turn, whatever order they were defined in. Their
+// signals take the suffix of the enclosing function plus their position, so each is unique.
+func expandFunction(op string, operands []string, suffix string, depth int, t systemState) (listing, bool) {
+	if depth > maxFunctionDepth {
+		t.clr("%s: %sfunctions nested too deeply%s", op, italic, reset)
+		return nil, not
+	}
+	function := make(listing, len(t.funcs[op].Body))
+	copy(function, t.funcs[op].Body)
+	funArgs, function := processFunction(suffix, t, function)
+	if !argsCorrect(op, funArgs, t.clr, len(operands)) {
+		return nil, not
+	}
+	expanded := make(listing, 0, len(function))
 	for i, o := range function {
-		if o.Opd == "" {
-			continue
+		_, isFunction := t.funcs[o.Op]
+		var opds []string
+		if o.Opd != "" {
+			opds = []string{o.Opd}
+			if isFunction {
+				opds = strings.Split(o.Opd, ",")
+			}
+			for j := range opds {
+				opds[j] = substituteArg(opds[j], operands)
+			}
+			o.Opd = strings.Join(opds, ",")
 		}
-		switch o.Opd {
-		case "@":
-			o.Opd = t.operands[0]
-		case "@1":
-			o.Opd = t.operands[1]
-		case "@2":
-			o.Opd = t.operands[2]
+		if !isFunction {
+			switch {
+			case o.Op == "seq": // list of numbers, see checkSeq
+				if v, ok := parseSeq(o.Opd); ok {
+					o.ber, o.num = v[0], yes
+				}
+			case o.Opd != "" && strings.ContainsAny(o.Opd[:1], "+-.0123456789"):
+				o.ber, o.num = parseType(o.Opd, o.Op)
+			}
+			expanded = append(expanded, o)
+			continue
 		}
-		if strings.ContainsAny(o.Opd[:1], "+-.0123456789") {
-			o.ber, o.num = parseType(o.Opd, o.Op)
+		nested, ok := expandFunction(o.Op, opds, sf("%s_%d", suffix, i), depth+1, t)
+		if !ok {
+			return nil, not
 		}
-		function[i] = o
+		expanded = append(expanded, nested...)
 	}
-	return function, yes
+	return expanded, yes
 }
 
-func processFunction(fun int, t systemState, f listing) (args, listing) {
+func substituteArg(opd string, operands []string) string {
+	switch opd {
+	case "@":
+		return operands[0]
+	case "@1":
+		return operands[1]
+	case "@2":
+		return operands[2]
+	case "@3":
+		return operands[3]
+	}
+	return opd
+}
+
+func processFunction(suffix string, t systemState, f listing) (args, listing) {
 	funArgs := args{}
 	for i, o := range f {
-		if o.Opd == "" {
+		if o.Opd == "" || o.Op == "seq" { // seq takes a list of numbers
 			continue
 		}
-		if _, in := t.signals[o.Opd]; in || isUppercaseInitialOrDefaultExported(o.Opd) {
-			continue
+		opds := []string{o.Opd}
+		if _, isFunction := t.funcs[o.Op]; isFunction {
+			opds = strings.Split(o.Opd, ",") // arguments of a nested function
 		}
-		funArgs = countFuncArgs(o.Opd, funArgs)
-		switch o.Opd[:1] {
-		case "^", "@":
-			continue
-		}
-		if strings.ContainsAny(o.Opd[:1], "+-.0123456789") {
-			if _, num := parseType(o.Opd, o.Op); num {
+		renamed := not
+		for j, opd := range opds {
+			if _, in := t.signals[opd]; in || opd == "" || isUppercaseInitialOrDefaultExported(opd) {
+				continue
+			}
+			funArgs = countFuncArgs(opd, funArgs)
+			switch opd[:1] {
+			case "^", "@":
 				continue
 			}
+			if strings.ContainsAny(opd[:1], "+-.0123456789") {
+				if _, num := parseType(opd, o.Op); num {
+					continue
+				}
+			}
+			// TODO add Exported signals here?
+			opds[j] += suffix
+			renamed = yes
 		}
-		// TODO add Exported signals here?
-		f[i].Opd += sf(".%d", fun)
-		switch o.Op {
-		case "out":
+		f[i].Opd = strings.Join(opds, ",")
+		if renamed && o.Op == "out" {
 			t.out[f[i].Opd] = assigned // implicitly de-referenced
 		}
 	}
@@ -985,6 +1905,8 @@ func countFuncArgs(opd string, funArgs args) args {
 		funArgs.at1 = yes
 	case "@2":
 		funArgs.at2 = yes
+	case "@3":
+		funArgs.at3 = yes
 	}
 	return funArgs
 }
@@ -992,14 +1914,16 @@ func countFuncArgs(opd string, funArgs args) args {
 func argsCorrect(op string, funArgs args, clr clear, l int) bool {
 	a := 0
 	switch funArgs {
-	case args{not, not, not}:
+	case args{not, not, not, not}:
 		// nop
-	case args{yes, not, not}:
+	case args{yes, not, not, not}:
 		a = 1
-	case args{yes, yes, not}:
+	case args{yes, yes, not, not}:
 		a = 2
-	case args{yes, yes, yes}:
+	case args{yes, yes, yes, not}:
 		a = 3
+	case args{yes, yes, yes, yes}:
+		a = 4
 	default:
 		clr("malformed function") // probably not needed
 		return not
@@ -1121,60 +2045,127 @@ func nyquist(n float64, e string) bool {
 			return false
 		}
 	}
-	return true
-}
-func bounds(a, b float64) bool {
-	return a < -b || a > b
+	return true
+}
+func bounds(a, b float64) bool {
+	return a < -b || a > b
+}
+
+// evaluateExpr evaluates + - * / with the usual precedence, unary signs and parentheses,
+// eg. 3/2, 1e-3-1e-2 or -(1+2)*3
+func evaluateExpr(expr string) (float64, bool) {
+	p := &exprParser{s: expr}
+	n, ok := p.sum()
+	if !ok {
+		return 0, false
+	}
+	if p.i < len(p.s) {
+		msg("%s is not a number", expr)
+		return 0, false
+	}
+	return n, true
+}
+
+// exprParser is a recursive descent parser for evaluateExpr, i is the position in s
+type exprParser struct {
+	s string
+	i int
+}
+
+func (p *exprParser) sum() (float64, bool) {
+	n, ok := p.product()
+	for ok && p.i < len(p.s) && (p.s[p.i] == '+' || p.s[p.i] == '-') {
+		op := p.s[p.i]
+		p.i++
+		var m float64
+		if m, ok = p.product(); op == '+' {
+			n += m
+		} else {
+			n -= m
+		}
+	}
+	return n, ok
 }
 
-// evaluateExpr() won't handle expressions containing eg. 1e-3-1e-2
-func evaluateExpr(expr string) (float64, bool) {
-	opds := []string{expr}
-	var rr error
-	var n, n2 float64
-	var op string
-	if n, rr = strconv.ParseFloat(opds[0], 64); !e(rr) {
-		return n, true
-	}
-	for _, v := range []string{"*", "/", "+", "-"} {
-		if strings.Contains(strings.TrimPrefix(expr, "-"), v) {
-			opds = strings.SplitN(expr, v, 2)
-			if strings.HasPrefix(expr, "-") {
-				opds = strings.SplitN(strings.TrimPrefix(expr, "-"), v, 2)
-				opds[0] = "-" + opds[0]
-			}
-			op = v
-			break
+func (p *exprParser) product() (float64, bool) {
+	n, ok := p.unary()
+	for ok && p.i < len(p.s) && (p.s[p.i] == '*' || p.s[p.i] == '/') {
+		op := p.s[p.i]
+		p.i++
+		var m float64
+		if m, ok = p.unary(); op == '*' {
+			n *= m
+		} else {
+			n /= m
 		}
 	}
-	if n, rr = strconv.ParseFloat(opds[0], 64); e(rr) {
-		msg("%s is not a number", opds[0])
+	return n, ok
+}
+
+func (p *exprParser) unary() (float64, bool) {
+	if p.i >= len(p.s) {
+		msg("%s%s is incomplete%s", p.s, italic, reset)
 		return 0, false
 	}
-	if len(opds) == 1 {
+	switch p.s[p.i] {
+	case '-':
+		p.i++
+		n, ok := p.unary()
+		return -n, ok
+	case '+':
+		p.i++
+		return p.unary()
+	case '(':
+		p.i++
+		n, ok := p.sum()
+		if !ok {
+			return 0, false
+		}
+		if p.i >= len(p.s) || p.s[p.i] != ')' {
+			msg("%s%s is missing )%s", p.s, italic, reset)
+			return 0, false
+		}
+		p.i++
 		return n, true
 	}
-	if len(opds) > 2 {
-		msg("%s third operand in expression ignored%s", italic, reset)
-		return 0, false
+	return p.number()
+}
+
+// number parses a float literal, an exponent sign isn't taken as subtraction
+func (p *exprParser) number() (float64, bool) {
+	j := p.i
+	digit := func(j int) bool { return j < len(p.s) && p.s[j] >= '0' && p.s[j] <= '9' }
+	for digit(j) || j < len(p.s) && (p.s[j] == '.' || p.s[j] == '_') {
+		j++
+	}
+	if j > p.i && j < len(p.s) && (p.s[j] == 'e' || p.s[j] == 'E') {
+		k := j + 1
+		if k < len(p.s) && (p.s[k] == '+' || p.s[k] == '-') {
+			k++
+		}
+		if digit(k) {
+			for j = k; digit(j); j++ {
+			}
+		}
 	}
-	if n2, rr = strconv.ParseFloat(opds[1], 64); e(rr) {
-		msg("%s is not a number", opds[1])
+	n, rr := strconv.ParseFloat(p.s[p.i:j], 64)
+	if e(rr) {
+		msg("%s is not a number", p.s[p.i:])
 		return 0, false
 	}
-	switch op {
-	case "*":
-		n *= n2
-	case "/":
-		n /= n2
-	case "+":
-		n += n2
-	case "-":
-		n -= n2
-	}
+	p.i = j
 	return n, true
 }
 
+const minPrintInterval = 1e-3 // seconds, see `: printrate`
+
+// logPrinted writes output of print to the info log, see `: printlog`
+func logPrinted() {
+	for s := range printed {
+		log.WriteString(sf("%s %s\n", time.Now().Format("15:04:05.000"), s)) // errors ignored
+	}
+}
+
 func infoIfLogging(s string, i ...interface{}) {
 	if !writeLog {
 		return
@@ -1183,10 +2174,22 @@ func infoIfLogging(s string, i ...interface{}) {
 	<-carryOn
 }
 
+// logEvent writes a timestamped line to the log, if started with --log or --events
+func logEvent(s string, i ...interface{}) {
+	if log == nil {
+		return
+	}
+	if _, err := log.WriteString(sf("%s %s\n", time.Now().Format("15:04:05.000"), sf(s, i...))); err != nil {
+		pf("logging error: %s", err)
+	}
+}
+
 func infoDisplay() {
 	file := "infodisplay.json"
 	c := 1
+	cl := 1
 	s := 1
+	ov := 0
 	display.Info = "clear"
 	for {
 		if writeLog {
@@ -1214,11 +2217,27 @@ func infoDisplay() {
 			display.Info = sf("%sSyntə closed%s", italic, reset)
 			display.On = not // stops timer in info display
 			display.Format = 0 // so previous soundcard info not displayed, in case different
+			display.Device = ""
 			saveJson(display, file)
 			return
 		default: // passthrough
 		}
 		time.Sleep(20 * time.Millisecond) // coarse loop timing
+		// events are logged once per timeout, for review after a performance
+		if display.Clip && c == 1 {
+			logEvent("clip")
+		}
+		if display.Clipl > -1 && cl == 1 {
+			logEvent("listing %d limited", display.Clipl)
+		}
+		if l := float64(display.Load) * display.SR / 1e9; l > 1 {
+			if ov == 0 {
+				logEvent("overload, load %.2f", l)
+			}
+			ov = 50 // 1s timeout
+		} else if ov > 0 {
+			ov--
+		}
 		if display.Clip {
 			c++
 		}
@@ -1226,6 +2245,13 @@ func infoDisplay() {
 			display.Clip = not
 			c = 1
 		}
+		if display.Clipl > -1 {
+			cl++
+		}
+		if cl > 20 { // same timeout for listing limiter
+			display.Clipl = -1
+			cl = 1
+		}
 		if display.Sync {
 			s++
 		}
@@ -1247,6 +2273,11 @@ func transfer(d []listingStack, tr *data) ([]listingStack, []int) {
 		sg := d[tr.reload].sigs
 		d[tr.reload].listing = tr.listing
 		d[tr.reload].sigs = tr.sigs
+		d[tr.reload].sends = tr.sends // derived from listing
+		d[tr.reload].sq.vals = tr.sq.vals
+		if l := len(d[tr.reload].buff); len(tr.buff) > l { // existing loops continue
+			d[tr.reload].buff = append(d[tr.reload].buff, tr.buff[l:]...)
+		}
 		if rst {
 			return d, tr.daisyChains
 		}
@@ -1259,9 +2290,48 @@ func transfer(d []listingStack, tr *data) ([]listingStack, []int) {
 		return d, tr.daisyChains
 	}
 	coreDump(tr.listingStack, "launched_listing")
+	tr.no = listingNoise(len(d))
+	tr.hold = quantum > 0
 	return append(d, tr.listingStack), tr.daisyChains
 }
 
+// operations which refer to a listing by index, renumbered by `: compact`
+var indexOps = map[int]bool{
+	28: yes, // level
+	29: yes, // from
+	38: yes, // pan
+	59: yes, // duck
+	68: yes, // depth
+	69: yes, // from~
+}
+
+// compact removes listings with a new index of -1, along with their mutes and levels.
+// A renumbered reference is written to an added signal, as the literal may be shared with other operations
+func compact(d []listingStack, index []int) []listingStack {
+	c := d[:0]
+	m, lv, b, dm := mutes[:0], levels[:0], bypassed[:0], display.Mute[:0]
+	for i, l := range d {
+		if i >= len(index) || index[i] < 0 {
+			continue
+		}
+		for ii, o := range l.listing {
+			if !indexOps[o.Opn] {
+				continue
+			}
+			n := int(l.sigs[o.N])
+			if n < 0 || n >= len(index) || index[n] == n {
+				continue
+			}
+			l.sigs = append(l.sigs, float64(index[n]))
+			l.listing[ii].N = len(l.sigs) - 1
+		}
+		c = append(c, l)
+		m, lv, b, dm = append(m, mutes[i]), append(lv, levels[i]), append(b, bypassed[i]), append(dm, display.Mute[i])
+	}
+	mutes, levels, bypassed, display.Mute = m, lv, b, dm
+	return c
+}
+
 // The Sound Engine does the bare minimum to generate audio
 // It is freewheeling, it won't block on the action of any other goroutine, only on IO, namely writing to soundcard
 // The latency and jitter of the audio output is entirely dependent on the soundcard and its OS driver,
@@ -1279,6 +2349,7 @@ func SoundEngine(sc soundcard, wavs [][]float64) {
 
 	const Tau = 2 * math.Pi
 	const RateIntegrationTime = 2 << 14 // to display load
+	const levelInterval = 4800           // samples between publishing listing levels, 0.1s at 48kHz
 
 	const (
 		run syncState = iota
@@ -1288,9 +2359,15 @@ func SoundEngine(sc soundcard, wavs [][]float64) {
 
 	var (
 		lpf15Hz = lpf_coeff(15, sc.sampleRate)
-		lpf1kHz = lpf_coeff(1e3, sc.sampleRate)
 		lpf2Hz  = lpf_coeff(2, sc.sampleRate)
 
+		grainInc = 1 / (grainLength * sc.sampleRate) // of stretch
+		lpfFrom  = lpf_coeff(fromSmooth, sc.sampleRate) // of from~
+		lpfBrown = lpf_coeff(brownCorner, sc.sampleRate)
+		lpfAutoGain = lpf_coeff(1/(Tau*autoGainTime), sc.sampleRate)
+		buttonStep  = 1 / (buttonRamp * sc.sampleRate)
+		launchStep  = 1 / (launchRamp * sc.sampleRate)
+
 		// per-listing limiter
 		hpf5120Hz = hpf_coeff(5120, sc.sampleRate)
 		hpf2s     = hpf_coeff(0.5, sc.sampleRate)
@@ -1310,12 +2387,19 @@ func SoundEngine(sc soundcard, wavs [][]float64) {
 		tapeLen = int(sc.sampleRate) * TAPE_LENGTH
 
 		l, ll, h float64 = Thr, Thr, 2 // limiter, hold
+		llMax    float64               // greatest limiting within levelInterval
+		lvs      [2][]float64          // listing levels, alternately published to display
 		env  float64 = 1      // for exit envelope
 		mid, // output
+		rearMid, rearSides, // quad output
+		rearHpf, rearX, // DC-blocking high pass filter of rear
 		peak, // vu meter
 		dither float64
 		n int // loop counter
 
+		transport float64 // position in beats, integrated from tempo
+		onGrid    bool    // transport has reached a multiple of quantum, see `: quantise`
+
 		rate     = time.Duration(7292) // loop timer, initialised to approximate resting rate
 		lastTime time.Time
 		rates    [RateIntegrationTime]time.Duration
@@ -1323,9 +2407,17 @@ func SoundEngine(sc soundcard, wavs [][]float64) {
 
 		s      float64 = 1    // sync=0
 		mx, my float64 = 1, 1 // mouse smooth intermediates
+		bl, br, bm     float64 // mouse buttons, ramped
+		tp, tx, ty     float64 // tablet smooth intermediates
+		in     stereoPair     // soundcard input
 		c, mixF = 4.0, 4.0    // mix factor
 		hpf, x float64        // DC-blocking high pass filter
 		g      float64        // gain smooth intermediate
+		ms     float64        // mean square of output before gain, for autogain
+		ag             = 1.0  // autogain
+		lvTime float64        // level smoothing time, follows levelTime
+		lvCoeff        = 1.0  // level smoothing coefficient
+		wd     float64 = 1    // width smooth intermediate
 		hiBand, hiBandPrev,
 		midBand, midBandPrev float64    // limiter pre-emphasis
 		α       = 1 / (sc.sampleRate/(2*math.Pi*194) + 1) // co-efficient for setmix
@@ -1336,6 +2428,8 @@ func SoundEngine(sc soundcard, wavs [][]float64) {
 		p       = 1.0                                     // pause variable
 
 		samples     = make(chan stereoPair, 2400) // buffer up to 50ms of samples (@ 48kHz), introduces latency
+		rearSamples = make(chan stereoPair, 2400) // rear channels for quad, sent before each of samples
+		quadOut     = sc.channels == "quad"
 		daisyChains = make([]int, 0, 16)          // made explicitly here to set capacity
 	)
 	defer close(samples)
@@ -1364,28 +2458,57 @@ func SoundEngine(sc soundcard, wavs [][]float64) {
 	 // if samples channel runs empty insert zeros instead and filter heavily
 	 // anonymous to use var n in scope
 	go func(w *bufio.Writer, sc soundcard) {
-		lpf := stereoPair{}
+		lpf, rear := stereoPair{}, stereoPair{}
+		received := func(s stereoPair) {
+			lpf.stereoLpf(s, 0.7)
+			if quadOut { // already sent
+				rear.stereoLpf(<-rearSamples, 0.7)
+			}
+		}
 		for env > 0 || n%1024 != 0 { // finish on end of buffer, should be determined in setupSouncard instead of this default
 			select {
 			case <-stop: // if panic has occurred n will no longer be incrementing, so return here
 				return
 			case s := <-samples:
-				lpf.stereoLpf(s, 0.7)
+				received(s)
 			default:
-				lpf.stereoLpf(stereoPair{}, lpf15Hz)
+				if !offline {
+					lpf.stereoLpf(stereoPair{}, lpf15Hz)
+					rear.stereoLpf(stereoPair{}, lpf15Hz)
+					underruns++
+					break
+				}
+				select { // Engine renders every sample, so wait
+				case <-stop:
+					return
+				case s := <-samples:
+					received(s)
+				}
+			}
+			if sc.channels == "mono" { // downmix, equivalent to mid
+				output(w, clip((lpf.left+lpf.right)*0.5)*sc.convFactor)
+				continue
 			}
 			L := clip(lpf.left) * sc.convFactor  // clip will display info
 			R := clip(lpf.right) * sc.convFactor // clip will display info
 			output(w, L)
 			output(w, R)
+			if quadOut {
+				output(w, clip(rear.left)*sc.convFactor)
+				output(w, clip(rear.right)*sc.convFactor)
+			}
 		}
 	}(w, sc)
 
 	tr := *<-transmit
+	tr.no = listingNoise(0)
 	d = append(d, tr.listingStack)
 	daisyChains = tr.daisyChains
 	accepted <- len(d)
 	coreDump(d[0], "first_listing")
+	if display.Paused { // staged, see --paused
+		p = 0
+	}
 
 	lastTime = time.Now()
 	for {
@@ -1398,11 +2521,42 @@ func SoundEngine(sc soundcard, wavs [][]float64) {
 			if rs && rootSync() {
 				lastTime = time.Now()
 			}
+		case rq := <-sigsReq:
+			switch {
+			case rq.i >= len(d):
+				rq.reply <- nil
+			case rq.sigs == nil:
+				rq.reply <- append([]float64(nil), d[rq.i].sigs...)
+			default:
+				copy(d[rq.i].sigs, rq.sigs)
+				rq.reply <- rq.sigs
+			}
+		case index := <-compactReq:
+			d = compact(d, index)
+			accepted <- len(d)
+		case w := <-wavBank:
+			wavs = w
+		case c := <-remote: // set on the last listing, the first receives it from the daisy chain
+			if c.Pitch != nil {
+				d[len(d)-1].sigs[2] = *c.Pitch
+			}
+			if c.Tempo != nil {
+				d[len(d)-1].sigs[3] = *c.Tempo
+			}
 		default:
 			// play
 		}
 		if p == 0 && d[0].m < 1e-4 { // -80dB
-			pause <- not // blocks until `: play`, bool is purely semantic
+		paused:
+			for {
+				select {
+				case pause <- not: // `: play`, bool is purely semantic
+					break paused
+				case t := <-transmit: // staged while paused, see --paused
+					d, daisyChains = transfer(d, t)
+					accepted <- len(d)
+				}
+			}
 			if exit {
 				break
 			}
@@ -1414,9 +2568,28 @@ func SoundEngine(sc soundcard, wavs [][]float64) {
 			no ^= 1 << 27
 		}
 
+		if duplex {
+			select {
+			case in = <-inputSamples:
+			default: // hold last input sample
+			}
+		}
+
+		if levelTime != lvTime {
+			lvTime = levelTime
+			lvCoeff = lpf_coeff(1/(Tau*lvTime), sc.sampleRate) // 1 for zero time, no smoothing
+		}
+
 		mo := mouse
 		mx = mx + (mo.X-mx)*lpf15Hz
 		my = my + (mo.Y-my)*lpf15Hz
+		bl = ramp(bl, mo.Left, buttonStep)
+		br = ramp(br, mo.Right, buttonStep)
+		bm = ramp(bm, mo.Middle, buttonStep)
+		tb := tablet
+		tp = tp + (tb.Pressure-tp)*lpf15Hz
+		tx = tx + (tb.TiltX-tx)*lpf15Hz
+		ty = ty + (tb.TiltY-ty)*lpf15Hz
 
 		//for i, l := range d { // this is incredibly slow
 	listings:
@@ -1426,16 +2599,43 @@ func SoundEngine(sc soundcard, wavs [][]float64) {
 			for ii := 0; ii < len(daisyChains); ii++ {
 				d[i].sigs[daisyChains[ii]] = d[(i+len(d)-1)%len(d)].sigs[daisyChains[ii]]
 			}
-			d[i].m = d[i].m + (p*mutes[i]-d[i].m)*lpf15Hz // anti-click filter
-			d[i].lv = d[i].lv + (levels[i]-d[i].lv)*lpf1kHz
+			if d[i].hold { // launched since the last grid boundary
+				if !onGrid && quantum > 0 { // released at once if turned off
+					continue listings
+				}
+				d[i].hold = not
+			}
+			b := 1.0
+			if bypassed[i] {
+				b = 0
+			}
+			d[i].m = d[i].m + (p*mutes[i]*b-d[i].m)*lpf15Hz // anti-click filter
+			if bypassed[i] && d[i].m < 1e-4 { // faded out, skip processing
+				continue listings
+			}
+			if muteSkip && mutes[i] == 0 && d[i].m < 1e-6 && !d[i].sends { // -120dB, output has settled
+				continue listings
+			}
+			if d[i].fadeIn < 1 { // linear fade-in of newly launched listing
+				d[i].fadeIn = math.Min(1, d[i].fadeIn+launchStep)
+			}
+			d[i].lv = d[i].lv + (levels[i]-d[i].lv)*lvCoeff
 			//sigs := d[i].sigs
 			// mouse values
 			d[i].sigs[4] = mx
 			d[i].sigs[5] = my
-			d[i].sigs[6] = mo.Left
-			d[i].sigs[7] = mo.Right
-			d[i].sigs[8] = mo.Middle
+			d[i].sigs[6] = bl
+			d[i].sigs[7] = br
+			d[i].sigs[8] = bm
+			d[i].sigs[11] = in.left
+			d[i].sigs[12] = in.right
+			d[i].sigs[13] = transport
+			d[i].sigs[14] = tp
+			d[i].sigs[15] = tx
+			d[i].sigs[16] = ty
 			r := 0.0
+			bf := 0                     // buffer of the next buff
+			d[i].stack = d[i].stack[:0] // unbalanced push or pop can't carry over to next sample
 			//op := 0
 			ll := len(d[i].listing)
 			for ii := 0; ii < ll; ii++ {
@@ -1499,7 +2699,7 @@ func SoundEngine(sc soundcard, wavs [][]float64) {
 						r = math.Min(-d[i].sigs[d[i].listing[ii].N], math.Max(d[i].sigs[d[i].listing[ii].N], r))
 					}
 				case 15: // "nois"
-					r *= no.ise() // roll a fresh one
+					r *= d[i].no.ise() // roll a fresh one
 					//if r > 0.9999 { panic("test") } // for testing
 				case 16: // "push"
 					d[i].stack = append(d[i].stack, r)
@@ -1507,10 +2707,16 @@ func SoundEngine(sc soundcard, wavs [][]float64) {
 						panic("stack_overflow")
 					}
 				case 17: // "pop"
+					if len(d[i].stack) == 0 { // underflow, shouldn't happen given checkPushPop
+						r = 0
+						break
+					}
 					r = d[i].stack[len(d[i].stack)-1]
 					d[i].stack = d[i].stack[:len(d[i].stack)-1]
 				case 18: // "buff"
-					d[i].buff[n%tapeLen] = r // record head
+					buff := d[i].buff[bf]
+					bf++
+					buff[n%tapeLen] = r // record head
 					tl := float64(tapeLen)
 					//t := math.Abs(math.Min(1/d[i].sigs[d[i].listing[ii].N], tl))
 					t := math.Mod((1 / d[i].sigs[d[i].listing[ii].N]), tl)
@@ -1519,10 +2725,10 @@ func SoundEngine(sc soundcard, wavs [][]float64) {
 					}
 					xa := (n + tapeLen - int(t)) % tapeLen
 					x := mod(float64(n+tapeLen)-(t), tl)
-					ta0 := d[i].buff[(n+tapeLen-int(t)-1)%tapeLen]
-					ta := d[i].buff[xa] // play heads
-					tb := d[i].buff[(n+tapeLen-int(t)+1)%tapeLen]
-					tb1 := d[i].buff[(n+tapeLen-int(t)+2)%tapeLen]
+					ta0 := buff[(n+tapeLen-int(t)-1)%tapeLen]
+					ta := buff[xa] // play heads
+					tb := buff[(n+tapeLen-int(t)+1)%tapeLen]
+					tb1 := buff[(n+tapeLen-int(t)+2)%tapeLen]
 					z := mod(x-float64(xa), tl-1) - 0.5 // to avoid end of loop clicks
 					// 4-point 4th order "optimal" interpolation filter by Olli Niemitalo
 					ev1, od1 := tb+ta, tb-ta
@@ -1536,15 +2742,19 @@ func SoundEngine(sc soundcard, wavs [][]float64) {
 				case 19: // "--"
 					r = d[i].sigs[d[i].listing[ii].N] - r
 				case 20: // "tap"
+					buff := d[i].buff[0] // of the most recent buff, or the first if none yet
+					if bf > 0 {
+						buff = d[i].buff[bf-1]
+					}
 					tl := float64(tapeLen)
 					//t := math.Abs(math.Min(1/d[i].sigs[d[i].listing[ii].N], tl))
 					t := math.Min(math.Abs(1/d[i].sigs[d[i].listing[ii].N]), tl)
 					xa := (n + tapeLen - int(t)) % tapeLen
 					x := mod(float64(n+tapeLen)-(t), tl)
-					ta0 := d[i].buff[(n+tapeLen-int(t)-1)%tapeLen]
-					ta := d[i].buff[xa] // play heads
-					tb := d[i].buff[(n+tapeLen-int(t)+1)%tapeLen]
-					tb1 := d[i].buff[(n+tapeLen-int(t)+2)%tapeLen]
+					ta0 := buff[(n+tapeLen-int(t)-1)%tapeLen]
+					ta := buff[xa] // play heads
+					tb := buff[(n+tapeLen-int(t)+1)%tapeLen]
+					tb1 := buff[(n+tapeLen-int(t)+2)%tapeLen]
 					z := mod(x-float64(xa), tl-1) - 0.5 // to avoid end of loop clicks
 					// 4-point 4th order "optimal" interpolation filter by Olli Niemitalo
 					ev1, od1 := tb+ta, tb-ta
@@ -1566,21 +2776,7 @@ func SoundEngine(sc soundcard, wavs [][]float64) {
 					r /= (r + 1)
 				case 22: // "wav"
 					r += 1 // to allow negative input to reverse playback
-					r = math.Abs(r)
-					l := len(wavs[int(d[i].sigs[d[i].listing[ii].N])])
-					r *= float64(l)
-					x1 := int(r) % l
-					w0 := wavs[int(d[i].sigs[d[i].listing[ii].N])][(l+int(r-1))%l]
-					w1 := wavs[int(d[i].sigs[d[i].listing[ii].N])][x1]
-					w2 := wavs[int(d[i].sigs[d[i].listing[ii].N])][int(r+1)%l]
-					w3 := wavs[int(d[i].sigs[d[i].listing[ii].N])][int(r+2)%l]
-					z := mod(r-float64(x1), float64(l-1)) - 0.5
-					ev1, od1 := w2+w1, w2-w1
-					ev2, od2 := w3+w0, w3-w0
-					c0 := ev1*0.42334633257225274 + ev2*0.07668732202139628
-					c1 := od1*0.26126047291143606 + od2*0.24778879018226652
-					c2 := ev1*-0.213439787561776841 + ev2*0.21303593243799016
-					r = (c2*z+c1)*z + c0
+					r = wavMorph(wavs, d[i].sigs[d[i].listing[ii].N], math.Abs(r))
 				case 23: // "8bit"
 					r = float64(int8(r*d[i].sigs[d[i].listing[ii].N])) / d[i].sigs[d[i].listing[ii].N]
 				case 24: // "index"
@@ -1593,6 +2789,19 @@ func SoundEngine(sc soundcard, wavs [][]float64) {
 					case r <= 0 && d[i].syncSt8 == run: // edge-detect
 						s = 0
 						display.Sync = yes
+						display.Beat++
+						if oscAddr != "" {
+							select {
+							case oscSync <- display.Beat:
+							default: // never block the sound engine
+							}
+						}
+						if isRoot {
+							select {
+							case rootBeat <- display.Beat:
+							default:
+							}
+						}
 						d[i].syncSt8 = on
 					case d[i].syncSt8 == on: // single sample pulse
 						s = 1
@@ -1608,6 +2817,9 @@ func SoundEngine(sc soundcard, wavs [][]float64) {
 					op = len(list) - 2
 				}*/
 				case 28: // "level", ".level"
+					if math.IsInf(r, 0) || r != r { // level filter would not recover
+						break
+					}
 					levels[int(d[i].sigs[d[i].listing[ii].N])] = r
 					//levels[Min(len(levels), int(d[i].sigs[d[i].listing[ii].N]))] = r // alternative
 				case 29: // "from"
@@ -1633,9 +2845,18 @@ func SoundEngine(sc soundcard, wavs [][]float64) {
 					r *= math.Min(1, math.Sqrt(40/(d[i].peakfreq*sc.sampleRate+20)))
 				case 35: // "print"
 					pd++ // unnecessary?
-					if (pd)%32768 == 0 && !exit {
-						info <- sf("listing %d: %.5g", i, r)
-						pd += int(no >> 50)
+					if pd%printInterval == 0 && !exit {
+						ch := info
+						if printLog {
+							ch = printed
+						}
+						select { // don't block, a fast print rate could fill the channel
+						case ch <- sf("listing %d: %.5g", i, r):
+						default:
+						}
+						if printJitter {
+							pd += int(no >> 50)
+						}
 					}
 				case 36: // "\\"
 					if r == 0 {
@@ -1643,7 +2864,13 @@ func SoundEngine(sc soundcard, wavs [][]float64) {
 					}
 					r = d[i].sigs[d[i].listing[ii].N] / r
 				case 38: // "pan", ".pan"
-					d[int(d[i].sigs[d[i].listing[ii].N])].pan = math.Max(-1, math.Min(1, r))
+					if r == r { // NaN isn't limited
+						d[int(d[i].sigs[d[i].listing[ii].N])].pan = math.Max(-1, math.Min(1, r))
+					}
+				case 68: // "depth", ".depth"
+					if r == r {
+						d[int(d[i].sigs[d[i].listing[ii].N])].depth = math.Max(-1, math.Min(1, r))
+					}
 				case 39: // "all"
 					// r := 0 // allow mixing in of preceding listing
 					c := 0.0
@@ -1658,7 +2885,7 @@ func SoundEngine(sc soundcard, wavs [][]float64) {
 					r /= math.Sqrt(c)
 				case 40: // "fft"
 					d[i].fftArr[n%N] = r
-					if n%N2 == 0 && n >= N && !d[i].ffrz {
+					if n%d[i].hop == 0 && n >= N && !d[i].ffrz {
 						nn := n % N
 						var zz [N]complex128
 						for n := range d[i].fftArr { // n is shadowed
@@ -1669,45 +2896,23 @@ func SoundEngine(sc soundcard, wavs [][]float64) {
 						d[i].z = fft(zz, 1)
 					}
 				case 41: // "ifft"
-					if n%N == 0 && n >= N {
-						zz := fft(d[i].z, -1)
-						for n, z := range zz { // n, z are shadowed
-							w := (1 - math.Cos(Tau*float64(n)*N1)) * 0.5 // Hann
-							d[i].ifftArr[n] = w * real(z) * invN2
-						}
-					}
-					if n%N == N2+1 && n >= N {
+					if n%d[i].hop == 0 && n >= N {
 						zz := fft(d[i].z, -1)
-						for n, z := range zz { // n, z are shadowed
-							w := (1 - math.Cos(Tau*float64(n)*N1)) * 0.5 // Hann
-							d[i].ifft2[n] = w * real(z) * invN2
+						g := invN2 * float64(2*d[i].hop) / N // Hann windows overlapped by N/hop sum to N/(2·hop)
+						for k, z := range zz { // z is shadowed
+							w := (1 - math.Cos(Tau*float64(k)*N1)) * 0.5 // Hann
+							d[i].ola[(n+k)%N] += w * real(z) * g
 						}
 					}
-					if !d[i].ffrz {
-						r = d[i].ifftArr[n%N] + d[i].ifft2[(n+N2)%N]
-					} else {
-						r = (d[i].ifftArr[n%N] + d[i].ifftArr[(n+N2)%N])
-					}
+					r = d[i].ola[n%N]
+					d[i].ola[n%N] = 0
 				case 42: // "fftrnc"
-					if n%N2 == 0 && n >= N && !d[i].ffrz {
-						switch {
-						case d[i].sigs[d[i].listing[ii].N] > 0:
-							l := int(N * d[i].sigs[d[i].listing[ii].N])
-							for n := l; n < N; n++ {
-								d[i].z[n] = complex(0, 0)
-							}
-						case d[i].sigs[d[i].listing[ii].N] < 0:
-							l := -int(N * d[i].sigs[d[i].listing[ii].N])
-							for n := range d[i].z {
-								if n > l || n < N-l {
-									d[i].z[n] = complex(0, 0)
-								}
-							}
-						}
+					if n%d[i].hop == 0 && n >= N && !d[i].ffrz {
+						truncateSpectrum(&d[i].z, d[i].sigs[d[i].listing[ii].N])
 					}
 				case 43: // "shfft"
 					s := d[i].sigs[d[i].listing[ii].N]
-					if n%N2 == 0 && n >= N && !d[i].ffrz {
+					if n%d[i].hop == 0 && n >= N && !d[i].ffrz {
 						l := int(mod(s, 1) * N)
 						for n := range d[i].z {
 							nn := (N + n + l) % N
@@ -1717,30 +2922,18 @@ func SoundEngine(sc soundcard, wavs [][]float64) {
 				case 44: // "ffrz"
 					d[i].ffrz = d[i].sigs[d[i].listing[ii].N] == 0
 				case 45: // "gafft"
-					if n%N2 == 0 && n >= N && !d[i].ffrz {
-						s := d[i].sigs[d[i].listing[ii].N] * 50
-						gt := yes
-						if s < 0 {
-							s = -s
-							gt = not
-						}
-						for n, zz := range d[i].z {
-							if gt && math.Abs(real(zz)) < s {
-								d[i].z[n] = 0
-							} else if !gt && math.Abs(real(zz)) > s {
-								d[i].z[n] = 0
-							}
-						}
+					if n%d[i].hop == 0 && n >= N && !d[i].ffrz {
+						gateSpectrum(&d[i].z, d[i].sigs[d[i].listing[ii].N])
 					}
 				case 46: // "rev"
-					if n%N2 == 0 && n >= N && !d[i].ffrz {
+					if n%d[i].hop == 0 && n >= N && !d[i].ffrz {
 						ii := i // from 'the blue book':
 						for i, j := 0, len(d[ii].z)-1; i < j; i, j = i+1, j-1 {
 							d[ii].z[i], d[ii].z[j] = d[ii].z[j], d[ii].z[i]
 						}
 					}
 				case 47: // "ffltr"
-					if n%N2 == 0 && n >= N && !d[i].ffrz {
+					if n%d[i].hop == 0 && n >= N && !d[i].ffrz {
 						coeff := complex(math.Abs(d[i].sigs[d[i].listing[ii].N]*N), 0)
 						coeff *= Tau
 						coeff /= (coeff + 1)
@@ -1750,15 +2943,15 @@ func SoundEngine(sc soundcard, wavs [][]float64) {
 						}
 					}
 				case 48: // "ffzy"
-					if n%N2 == 0 && n >= N && !d[i].ffrz {
+					if n%d[i].hop == 0 && n >= N && !d[i].ffrz {
 						for n := range d[i].z {
 							r, θ := cmplx.Polar(d[i].z[n])
-							θ += math.Pi * no.ise()
+							θ += math.Pi * d[i].no.ise()
 							d[i].z[n] = cmplx.Rect(r, θ)
 						}
 					}
 				case 49: // "ffaze"
-					if n%N2 == 0 && n >= N && !d[i].ffrz {
+					if n%d[i].hop == 0 && n >= N && !d[i].ffrz {
 						for n := range d[i].z {
 							r, θ := cmplx.Polar(d[i].z[n])
 							θ += Tau * d[i].sigs[d[i].listing[ii].N]
@@ -1766,7 +2959,7 @@ func SoundEngine(sc soundcard, wavs [][]float64) {
 						}
 					}
 				case 50: // "reu"
-					if n%N2 == 0 && n >= N && !d[i].ffrz {
+					if n%d[i].hop == 0 && n >= N && !d[i].ffrz {
 						ii := i // from 'the blue book':
 						for i, j := 0, len(d[ii].z)/2; i < j; i, j = i+1, j-1 {
 							d[ii].z[i], d[ii].z[j] = d[ii].z[j], d[ii].z[i]
@@ -1802,6 +2995,75 @@ func SoundEngine(sc soundcard, wavs [][]float64) {
 					// 4.7, 5.4, 9.1, 1.27 // alternative delays
 				case 53: // "panic"
 					panic("test")
+				case 54: // "pulse@"
+					r = pulse(&d[i].pulsePh, d[i].sigs[d[i].listing[ii].N])
+				case 55: // "compress"
+					r = d[i].cmp.compress(r, d[i].sigs[d[i].listing[ii].N])
+				case 56: // "cratio"
+					d[i].cmp.ratio = d[i].sigs[d[i].listing[ii].N]
+				case 57: // "cattack"
+					d[i].cmp.att = math.Min(1, d[i].sigs[d[i].listing[ii].N])
+				case 58: // "crelease"
+					d[i].cmp.rel = math.Min(1, d[i].sigs[d[i].listing[ii].N])
+				case 59: // "duck"
+					r = d[i].cmp.duck(r, d[int(d[i].sigs[d[i].listing[ii].N])%len(d)].sigs[0])
+				case 60: // "peak"
+					r = d[i].pk.peak(r, d[i].sigs[d[i].listing[ii].N])
+				case 61: // "pkgain"
+					d[i].pk.g = d[i].sigs[d[i].listing[ii].N]
+				case 62: // "pkq"
+					d[i].pk.q = d[i].sigs[d[i].listing[ii].N]
+				case 63: // "wrap"
+					r = wrap(r, d[i].sigs[d[i].listing[ii].N])
+				case 64: // "srr"
+					r = d[i].sr.reduce(r, d[i].sigs[d[i].listing[ii].N])
+				case 65: // "push!"
+					if len(d[i].pstack) < maxPersistStack { // further pushes are discarded
+						d[i].pstack = append(d[i].pstack, r)
+					}
+				case 66: // "pop!"
+					if len(d[i].pstack) == 0 {
+						r = 0
+						break
+					}
+					r = d[i].pstack[len(d[i].pstack)-1]
+					d[i].pstack = d[i].pstack[:len(d[i].pstack)-1]
+				case 67: // "stretch"
+					r = d[i].gr.stretch(wavs[int(d[i].sigs[d[i].listing[ii].N])], r, grainInc)
+				case 80: // "sratio"
+					d[i].gr.ratio = d[i].sigs[d[i].listing[ii].N]
+				case 69: // "from~"
+					d[i].fromSm += (d[int(d[i].sigs[d[i].listing[ii].N])%len(d)].sigs[0] - d[i].fromSm) * lpfFrom
+					r = d[i].fromSm
+				case 70: // "pnois"
+					r *= d[i].pn.filter(d[i].no.ise())
+				case 71: // "bnois"
+					r *= brownNoise(&d[i].brn, d[i].no.ise(), lpfBrown)
+				case 72: // "trig"
+					r = trig(&d[i].trigUp, r, yes)
+				case 73: // "trig-"
+					r = trig(&d[i].trigDn, r, not)
+				case 74: // "div"
+					if s == 0 { // sync pulse, so dividers can be aligned
+						d[i].dv.count = 0
+					}
+					r = d[i].dv.divide(r, d[i].sigs[d[i].listing[ii].N])
+				case 75: // "euc"
+					if s == 0 {
+						d[i].eu.step = 0
+					}
+					r = d[i].eu.hit(r, d[i].sigs[d[i].listing[ii].N])
+				case 76: // "eusteps"
+					d[i].eu.steps = d[i].sigs[d[i].listing[ii].N]
+				case 77: // "chance"
+					r = d[i].ch.chance(r, d[i].sigs[d[i].listing[ii].N], (d[i].no.ise()+1)*0.5)
+				case 78: // "seq"
+					if s == 0 {
+						d[i].sq.step = 0
+					}
+					r = d[i].sq.next(r)
+				case 79: // "out-"
+					d[i].sigs[d[i].listing[ii].N] -= r
 				default:
 					continue listings
 				}
@@ -1823,20 +3085,37 @@ func SoundEngine(sc soundcard, wavs [][]float64) {
 				panic(sf("listing: %d, %d - NaN", i, current))
 			}
 			c += d[i].m // add mute to mix factor
-			d[i].sigs[0] *= d[i].m * d[i].lv
+			d[i].sigs[0] *= d[i].m * d[i].lv * d[i].fadeIn
 			out := d[i].sigs[0]
 			d[i].limPre = ( d[i].limPre + out - d[i].limPreX ) * hpf5120Hz
 			d[i].limPreX = out
 			det := math.Abs(20 * d[i].limPre + 0.92 * out)
 			if det > d[i].lim+clipThr { // limiter
 				d[i].lim = d[i].lim + (math.Abs(out-clipThr)-d[i].lim)*lpf15Hz
+				display.Clipl = i
 			}
-			out /= (d[i].lim + clipThr) * (d[i].lim + clipThr + 4) / 5 // over-limit
+			out /= (d[i].lim + clipThr) * (d[i].lim + clipThr + 4) / (clipThr * (clipThr + 4)) // over-limit, unity below threshold
 			display.GR = d[i].lim > 3e-4
 			d[i].lim *= hpf2s // release
+			d[i].peak = math.Max(d[i].peak, math.Abs(out))
+			if quadOut { // constant power front to back
+				rear := out * math.Sqrt((1+d[i].depth)*0.5)
+				out *= math.Sqrt((1 - d[i].depth) * 0.5)
+				rearSides += rear * d[i].pan * 0.5
+				rearMid += rear * (1 - math.Abs(d[i].pan*0.5))
+			}
 			sides += out * d[i].pan * 0.5
 			mid += out * (1 - math.Abs(d[i].pan*0.5))
 		}
+		prev := transport
+		if rewind {
+			transport, rewind = 0, not
+			prev = -1 // zero is on the grid
+		}
+		tempo := d[len(d)-1].sigs[3] // as it returns to the first listing
+		transport += tempo
+		q := quantum
+		onGrid = tempo <= 0 || q > 0 && math.Floor(transport/q) != math.Floor(prev/q) // no grid without tempo
 		if c < 1 { // c = max(c, 1)
 			c = 1
 		}
@@ -1845,32 +3124,55 @@ func SoundEngine(sc soundcard, wavs [][]float64) {
 		c = 0
 		mid /= mixF
 		sides /= mixF
-		g += (gain - g)*lpf15Hz
+		switch {
+		case !autoGain: // return to unity as slowly
+			ag += (1 - ag) * lpfAutoGain
+		case ms > 1e-5: // -50dB, silence isn't raised
+			ag += (math.Max(1/autoGainRange, math.Min(autoGainRange, autoGainRef/math.Sqrt(ms))) - ag) * lpfAutoGain
+		}
+		ms += (mid*mid - ms) * lpfAutoGain
+		g += (gain*ag - g)*lpf15Hz
 		mid *= g
 		sides *= g
+		wd += (stereoWidth - wd) * lpf15Hz
+		sides *= wd
 		hpf = (hpf + mid - x) * hpf2point5Hz
 		x, mid = mid, hpf
 		// sidechain pre-emphasis
 		channelOR := math.Max(mid+sides, mid-sides)
+		if quadOut {
+			rearMid *= g / mixF
+			rearSides *= g * wd / mixF
+			rearHpf = (rearHpf + rearMid - rearX) * hpf2point5Hz
+			rearX, rearMid = rearMid, rearHpf
+			channelOR = math.Max(channelOR, math.Max(rearMid+rearSides, rearMid-rearSides))
+		}
 		hiBand = (hiBand + channelOR - hiBandPrev) * hiBandCoeff
 		hiBandPrev = channelOR
 		midBand = (midBand + channelOR - midBandPrev) * midBandCoeff
 		midBandPrev = channelOR
 		det := math.Abs(25*hiBand + 2.3*midBand + 0.9*channelOR)
 		if det > l+Thr { // limiter detection
-			l = det
+			l += (det - l) * limAttack // instant by default
 			h = release
 			display.GR = yes
 		}
-		mid /= ll+Thr // VCA
-		sides /= ll+Thr
+		if !masterBypass { // detection continues so there is no jump on return
+			mid /= ll+Thr // VCA
+			sides /= ll+Thr
+			rearMid /= ll+Thr
+			rearSides /= ll+Thr
+		}
 		h /= release
 		l *= release + 1/(h+1/(1-release))
 		ll += (l - ll) * lpf15Hz // low-pass filter to mitigate low-end modulation
 		display.GR = ll > 3e-4
+		llMax = math.Max(llMax, ll)
 		if exit {
 			mid *= env // fade out
 			sides *= env
+			rearMid *= env
+			rearSides *= env
 			env -= fade // linear fade-out (perceived as logarithmic)
 			if env < 0 {
 				time.Sleep(50 * time.Millisecond) // wait for 'glitch protection' go routine to complete
@@ -1892,12 +3194,28 @@ func SoundEngine(sc soundcard, wavs [][]float64) {
 		}
 		sides = math.Max(-0.5, math.Min(0.5, sides))
 		if record {
-			L := math.Max(-1, math.Min(1, mid+sides)) * sc.convFactor
-			R := math.Max(-1, math.Min(1, mid-sides)) * sc.convFactor
-			writeWav(L, R)
+			writeWav(recordSample(mid, sides, dither, sc.convFactor))
 		}
 		t = time.Since(lastTime)
-		samples <- stereoPair{left: mid + sides, right: mid - sides}
+		if quadOut {
+			rearMid = rearMid*hroom + dither/sc.convFactor
+			rearSides = math.Max(-0.5, math.Min(0.5, rearSides))
+			rearSamples <- stereoPair{left: rearMid + rearSides, right: rearMid - rearSides}
+		}
+		if offline { // output waits on Render, so listings are received meanwhile, see Engine.Launch
+		sent:
+			for {
+				select {
+				case samples <- stereoPair{left: mid + sides, right: mid - sides}:
+					break sent
+				case t := <-transmit:
+					d, daisyChains = transfer(d, t)
+					accepted <- len(d)
+				}
+			}
+		} else {
+			samples <- stereoPair{left: mid + sides, right: mid - sides}
+		}
 		lastTime = time.Now()
 		rate += t
 		rates[n%RateIntegrationTime] = t // rolling average buffer
@@ -1905,7 +3223,20 @@ func SoundEngine(sc soundcard, wavs [][]float64) {
 		if n%RateIntegrationTime == 0 {
 			display.Load = rate / RateIntegrationTime
 		}
+		if n%levelInterval == 0 { // publish listing levels
+			lv := lvs[n/levelInterval%2][:0] // reused, alternating so the slice last published isn't overwritten
+			for i := range d {
+				lv = append(lv, d[i].peak)
+				d[i].peak = 0
+			}
+			lvs[n/levelInterval%2] = lv
+			display.Level = lv
+			display.AutoGain = 20 * math.Log10(ag)
+			display.GRdb = 20 * math.Log10((llMax+Thr)/Thr) // reciprocal of VCA gain
+			llMax = 0
+		}
 		mid, sides = 0, 0
+		rearMid, rearSides = 0, 0
 		n++
 	}
 }
@@ -1939,44 +3270,269 @@ func (y *stereoPair) stereoLpf(x stereoPair, coeff float64) {
 }
 
 
-const width = 2 << 16 // precision of tanh table
-var tanhTab = make([]float64, width)
+const (
+	defaultTanhBits = 17 // 1MB table, fewer bits for less memory at the cost of precision
+	minTanhBits     = 8
+	maxTanhBits     = 20
+)
 
-/*
-var sineTab = make([]float64, int(SampleRate))
-func init() {
+var tanhTab []float64
+
+// calcTanhTab sizes the tanh table to 2^bits intervals over [0, 1], call before the sound engine starts.
+// Interpolation error is less than 0.1/4^bits
+func calcTanhTab(bits int) {
+	n := 1 << bits
+	tanhTab = make([]float64, n+1) // extra element for interpolation at the end
+	for i := range tanhTab {
+		tanhTab[i] = math.Tanh(float64(i) / float64(n))
+	}
+}
+
+var sineTab []float64
+
+// calcSineTab sizes the sine table to the sample rate, call on rate change before the sound engine starts
+func calcSineTab(sampleRate float64) {
+	sineTab = make([]float64, int(sampleRate)+1) // extra element for interpolation at the end
 	for i := range sineTab {
 		// using cosine, even function avoids negation for -ve x
-		sineTab[i] = math.Cos(2 * math.Pi * float64(i) / SampleRate)
+		sineTab[i] = math.Cos(2 * math.Pi * float64(i) / sampleRate)
 	}
-}*/
+}
 
 func init() {
-	for i := range tanhTab {
-		tanhTab[i] = math.Tanh(float64(i) / width)
-	}
+	calcTanhTab(defaultTanhBits)
+	calcSineTab(SampleRate)
+	launchSource = launchFromSource
 }
 
 const Tau = 2 * math.Pi
 
-func sine(x float64) float64 {
-	return math.Cos(Tau * x)
-	/*
-	   	if x < 0 {
-	   		x = -x
-	   	}
+// compressor is a feed-forward peak compressor, one per listing
+type compressor struct {
+	ratio,
+	att, // attack and release are one-pole coefficients, from eg. 5ms
+	rel,
+	env,
+	keyEnv float64 // envelope of duck key
+}
 
-	   sr := int(SampleRate)
-	   a := int(x * SampleRate)
-	   sa := sineTab[a%sr]
-	   sb := sineTab[(a+1)%sr]
-	   xx := mod((x*SampleRate)-float64(a), SampleRate-1)
-	   return sa + ((sb - sa) * xx) // linear interpolation
-	*/
+// compress follows the envelope of x and attenuates x when the envelope is above threshold thr
+func (c *compressor) compress(x, thr float64) float64 {
+	a := math.Abs(x)
+	switch {
+	case a > c.env:
+		c.env += (a - c.env) * c.att
+	default:
+		c.env += (a - c.env) * c.rel
+	}
+	return x * compGain(c.env, thr, c.ratio)
+}
+
+const duckThr = 0.0316 // -30dB, threshold of duck
+
+// duck follows the envelope of key and attenuates x when the envelope is above duckThr.
+// A deleted key listing outputs zero, so the envelope releases as if the key were silent
+func (c *compressor) duck(x, key float64) float64 {
+	a := math.Abs(key)
+	switch {
+	case a > c.keyEnv:
+		c.keyEnv += (a - c.keyEnv) * c.att
+	default:
+		c.keyEnv += (a - c.keyEnv) * c.rel
+	}
+	return x * compGain(c.keyEnv, duckThr, c.ratio)
+}
+
+// biquad is a peaking filter, one per listing. Coefficients are recalculated when parameters change
+type biquad struct {
+	f, g, q, // centre frequency as fraction of sample rate, linear gain, Q
+	cf, cg, cq, // parameters of current coefficients
+	b0, b1, b2, a1, a2,
+	x1, x2, y1, y2 float64
+}
+
+// coeffs calculates peaking filter coefficients from the Audio EQ Cookbook (R. Bristow-Johnson)
+func (b *biquad) coeffs() {
+	b.cf, b.cg, b.cq = b.f, b.g, b.q
+	A := math.Sqrt(math.Abs(b.g)) // gain is given as amplitude, eg. 6db
+	w := Tau * math.Min(math.Abs(b.f), 0.49)
+	alpha := math.Sin(w) / (2 * math.Max(b.q, 1e-3))
+	a0 := 1 + alpha/A
+	b.b0 = (1 + alpha*A) / a0
+	b.b1 = -2 * math.Cos(w) / a0
+	b.b2 = (1 - alpha*A) / a0
+	b.a1 = b.b1
+	b.a2 = (1 - alpha/A) / a0
+}
+
+// peak filters x with centre frequency f
+func (b *biquad) peak(x, f float64) float64 {
+	b.f = f
+	if b.f != b.cf || b.g != b.cg || b.q != b.cq {
+		b.coeffs()
+	}
+	y := b.b0*x + b.b1*b.x1 + b.b2*b.x2 - b.a1*b.y1 - b.a2*b.y2
+	b.x2, b.x1 = b.x1, x
+	b.y2, b.y1 = b.y1, y
+	return y
+}
+
+// compGain is the static gain curve, with a hard knee at threshold thr
+func compGain(env, thr, ratio float64) float64 {
+	if env <= thr || thr <= 0 || ratio <= 1 {
+		return 1
+	}
+	return math.Pow(env/thr, 1/ratio-1)
+}
+
+// reducer holds its input to reduce the effective sample rate
+type reducer struct {
+	ph, held float64
+}
+
+// reduce updates the held value at rate f, given as a fraction of the sample rate (eg. 4khz).
+// f greater than 1 is taken as the hold period in samples
+func (s *reducer) reduce(x, f float64) float64 {
+	if f > 1 {
+		f = 1 / f
+	}
+	if pulse(&s.ph, f) == 1 {
+		s.held = x
+	}
+	return s.held
+}
+
+// pulse advances phase ph by f, returning 1 for the single sample on which ph wraps, 0 otherwise
+func pulse(ph *float64, f float64) float64 {
+	*ph += f
+	if *ph < 1 {
+		return 0
+	}
+	*ph -= math.Floor(*ph)
+	return 1
+}
+
+const buttonRamp = 5e-3 // seconds, anti-click for mouse buttons
+const launchRamp = 5e-3 // seconds, anti-click fade-in of a newly launched listing
+
+// ramp moves y linearly towards x by step, unlike a low pass filter it arrives exactly.
+// So a mouse button ramped from 1 still crosses zero on release, as `trig-` expects
+func ramp(y, x, step float64) float64 {
+	if math.Abs(x-y) <= step {
+		return x
+	}
+	if x > y {
+		return y + step
+	}
+	return y - step
+}
+
+// trig returns 1 for the single sample on which x crosses zero, upwards if rising, 0 otherwise
+func trig(prev *float64, x float64, rising bool) float64 {
+	p := *prev
+	*prev = x
+	if (rising && p <= 0 && x > 0) || (!rising && p > 0 && x <= 0) {
+		return 1
+	}
+	return 0
+}
+
+// divider counts rising edges of input, as trig
+type divider struct {
+	count int
+	prev  float64
+}
+
+// divide returns 1 on the first and every nth rising edge after, 0 otherwise. If n is reduced
+// below the count the next edge is output, so no beat is skipped
+func (v *divider) divide(x, n float64) float64 {
+	if trig(&v.prev, x, yes) == 0 {
+		return 0
+	}
+	if v.count >= int(math.Max(1, n)) {
+		v.count = 0
+	}
+	v.count++
+	if v.count == 1 {
+		return 1
+	}
+	return 0
+}
+
+// euclidean distributes hits as evenly as possible over steps, advancing a step
+// on each rising edge of input
+type euclidean struct {
+	step  int
+	steps float64
+	prev  float64
+}
+
+// hit returns 1 on a rising edge if the current step is a hit, 0 otherwise. The pattern
+// is found from the step each time, so hits and steps may change at any point
+func (u *euclidean) hit(x, hits float64) float64 {
+	if trig(&u.prev, x, yes) == 0 {
+		return 0
+	}
+	n := int(math.Max(1, u.steps))
+	k := int(math.Max(0, math.Min(float64(n), hits)))
+	u.step %= n
+	h := u.step*k%n < k // Bresenham's line, a rotation of Bjorklund's algorithm
+	u.step++
+	if h {
+		return 1
+	}
+	return 0
+}
+
+// gate passes or blocks input from one rising edge to the next
+type gate struct {
+	prev float64
+	pass bool
+}
+
+// chance passes x with probability p, u is uniform random in [0, 1] and is only
+// used on a rising edge, so a gate held open isn't chopped up
+func (g *gate) chance(x, p, u float64) float64 {
+	if trig(&g.prev, x, yes) == 1 {
+		g.pass = p >= 1 || u < p
+	}
+	if !g.pass {
+		return 0
+	}
+	return x
+}
+
+// sequence steps through vals on each rising edge of input, holding each value until the next
+type sequence struct {
+	vals []float64
+	step int
+	prev float64
+	v    float64
+}
+
+func (q *sequence) next(x float64) float64 {
+	if trig(&q.prev, x, yes) == 1 && len(q.vals) > 0 {
+		q.step %= len(q.vals) // list may be shorter after reload
+		q.v = q.vals[q.step]
+		q.step++
+	}
+	return q.v
+}
+
+func sine(x float64) float64 {
+	x -= math.Floor(x)
+	if !(x >= 0 && x < 1) { // NaN or Inf
+		return math.Cos(Tau * x)
+	}
+	x *= float64(len(sineTab) - 1)
+	a := int(x)
+	sa := sineTab[a]
+	sb := sineTab[a+1]
+	return sa + ((sb - sa) * (x - float64(a))) // linear interpolation
 }
 
 func tanh(x float64) float64 {
-	if x < -1 || x > 1 {
+	if !(x > -1 && x < 1) { // also NaN
 		return math.Tanh(x)
 	}
 	neg := not
@@ -1984,8 +3540,7 @@ func tanh(x float64) float64 {
 		neg = yes
 		x = -x
 	}
-	w := (width - 2.0) // slightly imprecise
-	x *= w
+	x *= float64(len(tanhTab) - 1)
 	a := int(x)
 	ta := tanhTab[a]
 	tb := tanhTab[a+1]
@@ -1996,6 +3551,15 @@ func tanh(x float64) float64 {
 	return ta + ((tb - ta) * xx)
 }
 
+// recordSample scales a dithered output sample for recording, which is 16bit whatever the output format.
+// Dither of ±1 at the output's bit depth is exchanged for ±1 at 16bit
+func recordSample(mid, sides, dither, convFactor float64) (L, R float64) {
+	mid += dither/math.MaxInt16 - dither/convFactor
+	L = math.Max(-1, math.Min(1, mid+sides)) * math.MaxInt16
+	R = math.Max(-1, math.Min(1, mid-sides)) * math.MaxInt16
+	return L, R
+}
+
 func (n *noise) ise() float64 {
 	*n ^= *n << 13
 	*n ^= *n >> 7
@@ -2003,6 +3567,30 @@ func (n *noise) ise() float64 {
 	return float64(*n)*twoInvMaxUint - 1
 }
 
+// pinkNoise filters white noise to -3dB per octave, Paul Kellet's economy method.
+// Coefficients are for 44.1kHz but are close enough at other rates
+type pinkNoise [3]float64
+
+const pinkGain = 1.0 / 3 // approximately the rms level of white
+
+func (p *pinkNoise) filter(white float64) float64 {
+	p[0] = 0.99765*p[0] + white*0.0990460
+	p[1] = 0.96300*p[1] + white*0.2965164
+	p[2] = 0.57000*p[2] + white*1.0526913
+	return (p[0] + p[1] + p[2] + white*0.1848) * pinkGain
+}
+
+const (
+	brownCorner = 20 // Hz, below which brown noise is flat, so it doesn't drift to DC
+	brownGain   = 27 // approximately the rms level of white
+)
+
+// brownNoise integrates white noise with a leak, which is a low pass filter at brownCorner
+func brownNoise(y *float64, white, coeff float64) float64 {
+	*y += (white - *y) * coeff
+	return *y * brownGain
+}
+
 //var invMaxInt32 = 1.0 / math.MaxInt32
 
 func mod(x, y float64) float64 {
@@ -2026,12 +3614,136 @@ func mod(x, y float64) float64 {
 	   m := uint32(math.MaxInt32 * x / y)
 	   //m %= uint32(MaxInt32*y) // dirty mod
 
-	   	if pos {
-	   		return float64(m) * invMaxInt32
-	   	}
+	   	if pos {
+	   		return float64(m) * invMaxInt32
+	   	}
+
+	   return -float64(m) * invMaxInt32
+	*/
+}
+
+// wrap is floored modulo, unlike mod the result has the sign of y. eg. wrap(-0.25, 1) = 0.75
+func wrap(x, y float64) float64 {
+	if y == 0 {
+		return 0
+	}
+	w := x - y*math.Floor(x/y)
+	if w == y { // rounding of tiny negative x
+		return 0
+	}
+	return w
+}
+
+// wavMorph plays the wav at index x at phase r. A fractional index crossfades between
+// adjacent wavs, so the bank can be used as a wavetable. Bounded to the wavs loaded
+func wavMorph(wavs [][]float64, x, r float64) float64 {
+	if len(wavs) == 0 {
+		return 0
+	}
+	x = math.Max(0, math.Min(float64(len(wavs)-1), x))
+	w := int(x)
+	if f := x - float64(w); f > 0 {
+		return wavSample(wavs[w], r)*(1-f) + wavSample(wavs[w+1], r)*f
+	}
+	return wavSample(wavs[w], r)
+}
+
+// wavSample interpolates w at phase r, 4-point 2nd order optimal
+func wavSample(w []float64, r float64) float64 {
+	l := len(w)
+	if l == 0 {
+		return 0
+	}
+	r *= float64(l)
+	x1 := int(r) % l
+	w0 := w[(l+int(r-1))%l]
+	w1 := w[x1]
+	w2 := w[int(r+1)%l]
+	w3 := w[int(r+2)%l]
+	z := mod(r-float64(x1), float64(l-1)) - 0.5
+	ev1, od1 := w2+w1, w2-w1
+	ev2, od2 := w3+w0, w3-w0
+	c0 := ev1*0.42334633257225274 + ev2*0.07668732202139628
+	c1 := od1*0.26126047291143606 + od2*0.24778879018226652
+	c2 := ev1*-0.213439787561776841 + ev2*0.21303593243799016
+	return (c2*z+c1)*z + c0
+}
+
+const grainLength = 50e-3 // seconds, of stretch
+
+// granulator reads a wav at its original pitch with two Hann windowed grains, half a grain apart.
+// Each grain starts from the position given by input, so duration is independent of pitch.
+// With a ratio set by sratio the position also advances by itself, the input being an offset
+type granulator struct {
+	ph    float64    // phase of the first grain, the second is offset by 0.5
+	start [2]float64 // position in wav each grain started from, in samples
+	ratio float64    // duration as a multiple of the wav's, 0 to follow input only
+	pos   float64    // position advanced by ratio, as a fraction of the wav
+}
+
+// stretch returns the next sample of w, where p is the position in w as a fraction of its length
+// and inc is the grain phase increment per sample
+func (g *granulator) stretch(w []float64, p, inc float64) float64 {
+	l := float64(len(w))
+	if l == 0 {
+		return 0
+	}
+	if g.ratio > 0 {
+		g.pos = wrap(g.pos+1/(g.ratio*l), 1)
+		p += g.pos
+	}
+	pos := wrap(p, 1) * l
+	prev := g.ph
+	g.ph += inc
+	if g.ph >= 1 {
+		g.ph -= 1
+		g.start[0] = pos
+	}
+	if prev < 0.5 && g.ph >= 0.5 {
+		g.start[1] = pos
+	}
+	out := 0.0
+	for k, ph := range [2]float64{g.ph, wrap(g.ph+0.5, 1)} {
+		x := wrap(g.start[k]+ph/inc, l)
+		i := int(x)
+		f := x - float64(i)
+		s := w[i%len(w)]*(1-f) + w[(i+1)%len(w)]*f
+		out += s * 0.5 * (1 - sine(ph)) // Hann windows of both grains sum to 1
+	}
+	return out
+}
 
-	   return -float64(m) * invMaxInt32
-	*/
+// truncateSpectrum zeroes bins at and above frequency bin N·p for positive p (low-pass),
+// or below N·|p| for negative p (high-pass). Each bin n is zeroed along with its
+// conjugate N-n, to keep the Hermitian symmetry of a real signal
+func truncateSpectrum(z *[N]complex128, p float64) {
+	l := int(N * math.Abs(p))
+	for n := range z {
+		k := n // frequency of bin
+		if k > N2 {
+			k = N - n
+		}
+		if (p > 0 && k >= l) || (p < 0 && k < l) {
+			z[n] = 0
+		}
+	}
+}
+
+// gateSpectrum zeroes bins with magnitude below 50·s, or above 50·|s| for negative s
+func gateSpectrum(z *[N]complex128, s float64) {
+	s *= 50
+	gt := yes
+	if s < 0 {
+		s = -s
+		gt = not
+	}
+	for n, zz := range z {
+		if gt && cmplx.Abs(zz) < s {
+			z[n] = 0
+		} else if !gt && cmplx.Abs(zz) > s {
+			z[n] = 0
+		}
+	}
 }
 
 const (
@@ -2091,18 +3803,21 @@ func checkOut(s systemState) (systemState, int) {
 	case s.operand[:1] == "@":
 		return s, s.clr("%scan't send to @, represents function operand%s", italic, reset)
 	case isUppercaseInitialOrDefaultExported(s.operand):
-		if _, exp := s.exportedSignals[s.operand]; !exp && s.operator ==  "out+" {
+		if _, exp := s.exportedSignals[s.operand]; !exp && (s.operator == "out+" || s.operator == "out-") {
 			msg("remember to reset %s with `in 0` once in the cycle", s.operand)
 		}
 		return s, nextOperation
-	case s.operator == "out+":
+	case s.operator == "out+", s.operator == "out-":
 		priorOut := not
 		for _, o := range s.newListing {
 			if o.Op == "out" && o.Opd == s.operand {
 				priorOut = yes
 			}
 		}
-		if !priorOut {
+		switch {
+		case !priorOut && s.operator == "out-": // as out would store +r
+			return s, s.clr("%s: %suse out before out- to subtract from the signal%s", s.operand, italic, reset)
+		case !priorOut:
 			msg("%sfirst instance changed to%s out", italic, reset)
 			s.operator = "out"
 		}
@@ -2134,6 +3849,25 @@ func checkIn(s systemState) (systemState, int) {
 	return s, nextOperation
 }
 
+// functionCycle returns the operation of body which leads back to name, directly or through other
+// functions. Nested functions are expanded when used, so a cycle would never end
+func functionCycle(name string, body listing, funcs map[string]fn, seen map[string]bool) (string, bool) {
+	for _, o := range body {
+		if o.Op == name {
+			return o.Op, yes
+		}
+		f, isFunction := funcs[o.Op]
+		if !isFunction || seen[o.Op] {
+			continue
+		}
+		seen[o.Op] = yes
+		if _, ok := functionCycle(name, f.Body, funcs, seen); ok {
+			return o.Op, yes
+		}
+	}
+	return "", not
+}
+
 func endFunctionDefine(t systemState) (systemState, int) {
 	if !t.fIn || len(t.newListing[t.st+1:]) < 1 {
 		msg("%sno function definition%s", italic, reset)
@@ -2147,11 +3881,16 @@ func endFunctionDefine(t systemState) (systemState, int) {
 		}
 	}
 	name := t.newListing[t.st].Opd
+	if op, ok := functionCycle(name, t.newListing[t.st+1:], t.funcs, map[string]bool{}); ok {
+		msg("%sfunction %s%s%s would refer to itself through%s %s", italic, reset, name, italic, reset, op)
+		t.fIn = not
+		return t, startNewListing
+	}
 	t.hasOperand[name] = h
 	t.funcs[name] = fn{Comment: t.funcs[name].Comment, Body: t.newListing[t.st+1:]}
 	msg("%sfunction %s%s%s ready%s.", italic, reset, name, italic, reset)
 	if t.funcsave {
-		if !saveJson(t.funcs, "functions.json") {
+		if !saveFunctions(t.funcs) {
 			msg("function not saved!")
 		} else {
 			msg("%sfunction saved%s", italic, reset)
@@ -2182,10 +3921,139 @@ func checkPushPop(s systemState) (systemState, int) {
 	return s, nextOperation
 }
 
-func buffUnique(s systemState) (systemState, int) {
+const maxBuffs = 8 // per listing, each of TAPE_LENGTH
+
+func buffLimit(s systemState) (systemState, int) {
+	c := 0
 	for _, o := range s.newListing {
 		if o.Op == "buff" {
-			msg("%sonly one buff per listing%s", italic, reset)
+			c++
+		}
+	}
+	if c >= maxBuffs {
+		msg("%sonly%s %d %sbuffs per listing%s", italic, reset, maxBuffs, italic, reset)
+		return s, startNewOperation
+	}
+	return s, nextOperation
+}
+
+// buffLoops allocates a tape loop for each buff in l, or one for tap alone
+func buffLoops(l listing, tapeLen int) [][]float64 {
+	var b [][]float64
+	tap := not
+	for _, o := range l {
+		switch o.Op {
+		case "buff":
+			b = append(b, make([]float64, tapeLen))
+		case "tap":
+			tap = yes
+		}
+	}
+	if len(b) == 0 && tap {
+		b = append(b, make([]float64, tapeLen))
+	}
+	return b
+}
+
+func checkBias(s systemState) (systemState, int) {
+	if !s.num.Is && !(s.operand == "@" && s.fIn) {
+		msg("%sbias requires a number, eg.%s bias 0.5", italic, reset)
+		return s, startNewOperation
+	}
+	return s, nextOperation
+}
+
+func srrUnique(s systemState) (systemState, int) {
+	for _, o := range s.newListing {
+		if o.Op == "srr" {
+			msg("%sonly one srr per listing%s", italic, reset)
+			return s, startNewOperation
+		}
+	}
+	return s, nextOperation
+}
+
+func stretchUnique(s systemState) (systemState, int) {
+	for _, o := range s.newListing {
+		if o.Op == "stretch" {
+			msg("%sonly one stretch per listing%s", italic, reset)
+			return s, startNewOperation
+		}
+	}
+	return checkWav(s)
+}
+
+// fromSmooth is the cut-off of from~, high enough to pass most audio
+// but removing the steps of a source that changes abruptly
+const fromSmooth = 2000
+
+func fromUnique(s systemState) (systemState, int) {
+	for _, o := range s.newListing {
+		if o.Op == "from~" {
+			msg("%sonly one from~ per listing%s", italic, reset)
+			return s, startNewOperation
+		}
+	}
+	return checkIndex(s)
+}
+
+func duckUnique(s systemState) (systemState, int) { // key envelope is in the listing's compressor
+	s, r := perListingUnique(s)
+	if r != nextOperation {
+		return s, r
+	}
+	return checkIndex(s)
+}
+
+// oneEach are operators with a single state in the listing, also checked within functions
+var oneEach = map[string]bool{"trig": yes, "trig-": yes, "div": yes, "euc": yes, "chance": yes, "seq": yes, "compress": yes, "peak": yes, "duck": yes}
+
+func perListingUnique(s systemState) (systemState, int) { // for operators with state in listingStack
+	for _, o := range s.newListing {
+		if o.Op == s.operator {
+			msg("%sonly one %s per listing%s", italic, s.operator, reset)
+			return s, startNewOperation
+		}
+	}
+	return s, nextOperation
+}
+
+// checkSeq parses the values of seq, eg. `seq 440hz,550hz,660hz`. The operand
+// is assigned as a number, the first value, so that it isn't taken to be a signal
+func checkSeq(s systemState) (systemState, int) {
+	s, r := perListingUnique(s)
+	if r != nextOperation {
+		return s, r
+	}
+	v, ok := parseSeq(s.operand)
+	if !ok {
+		return s, startNewOperation // error reported by parseSeq
+	}
+	s.num.Ber, s.num.Is = v[0], yes
+	return s, nextOperation
+}
+
+func parseSeq(opd string) ([]float64, bool) {
+	vals := strings.Split(opd, ",")
+	v := make([]float64, len(vals))
+	for i, val := range vals {
+		if val == "" {
+			msg("%sseq: empty value%s %d", italic, reset, i+1)
+			return nil, not
+		}
+		n, ok := parseType(val, "seq")
+		if !ok {
+			return nil, not // parseType will report error
+		}
+		v[i] = n
+	}
+	return v, yes
+}
+
+func pulseUnique(s systemState) (systemState, int) {
+	for _, o := range s.newListing {
+		if o.Op == "pulse@" {
+			msg("%sonly one pulse@ per listing%s", italic, reset)
 			return s, startNewOperation
 		}
 	}
@@ -2220,21 +4088,67 @@ func excludeCurrent(op string, i, l int) bool {
 	return not
 }
 
+// eraseOperations recompiles the listing without its last n operations, so `erase 1` removes the
+// most recent. An operator or function as operand erases one and continues with that operator,
+// so that `erase` may be followed directly by a replacement, eg. `erase lpf 200hz`
 func eraseOperations(s systemState) (systemState, int) {
+	next := ""
+	if _, in := s.hasOperand[s.operand]; in {
+		next, s.operand = s.operand, "1"
+	}
 	n, ok := parseIndex(s.listingState, len(s.dispListing))
 	if !ok {
 		return s, startNewOperation // error reported by parseIndex
 	}
-	for i := 0; i < len(s.dispListing)-n; i++ { // recompile
+	r := len(s.dispListing) - n
+	msg("%s%d erased,%s %d %sremaining%s", italic, n, reset, r, italic, reset)
+	for i := 0; i < r; i++ { // recompile
 		tokens <- token{s.dispListing[i].Op, -1, yes}
 		if len(s.dispListing[i].Opd) > 0 { // dodgy?
 			tokens <- token{s.dispListing[i].Opd, -1, yes}
 		}
 	}
 	tokens <- token{"", -1, not}
+	if next != "" {
+		tokens <- token{next, -1, not}
+	}
 	return s, startNewListing
 }
 
+// undoOperation removes the last operation entered, along with the contents of a function.
+// Unlike erase nothing is recompiled. A pending do is cancelled instead
+func undoOperation(t *systemState) {
+	if t.do > 0 {
+		msg("%srepeat cancelled%s", italic, reset)
+		return
+	}
+	n := len(t.dispListing) - 1
+	if n < 0 {
+		msg("%snothing to undo%s", italic, reset)
+		return
+	}
+	o := t.dispListing[n]
+	if o.Op == "]" {
+		msg("%sfunction already defined, use%s erase", italic, reset)
+		return
+	}
+	for _, o := range t.newListing[t.marks[n]:] {
+		if o.Op == "out" {
+			delete(t.out, o.Opd)
+		}
+	}
+	if o.Op == "[" {
+		t.fIn = not
+	}
+	t.newListing = t.newListing[:t.marks[n]]
+	t.dispListing, t.marks = t.dispListing[:n], t.marks[:n]
+	msg("%sundone:%s %s %s", italic, reset, o.Op, o.Opd)
+	pf("\r")
+	for _, o := range t.dispListing {
+		pf("\t%s %s\n", o.Op, o.Opd)
+	}
+}
+
 func checkWav(s systemState) (systemState, int) {
 	if s.wmap[s.operand] || (s.operand == "@" && s.fIn) {
 		return s, nextOperation
@@ -2242,6 +4156,25 @@ func checkWav(s systemState) (systemState, int) {
 	return s, s.clr("%s %sisn't in wav list%s", s.operand, italic, reset)
 }
 
+// checkWavIndex allows wav to take the index of a loaded wav as a number or assigned signal,
+// as well as a name. Signals are bounded by the sound engine, see wavMorph
+func checkWavIndex(s systemState) (systemState, int) {
+	if s.wmap[s.operand] || (s.operand == "@" && s.fIn) {
+		return s, nextOperation
+	}
+	switch _, assigned := s.out[s.operand]; {
+	case len(s.wmap) == 0:
+		return s, s.clr("%sno wavs loaded%s", italic, reset)
+	case s.num.Is && s.num.Ber >= 0 && s.num.Ber <= float64(len(s.wmap)-1):
+		return s, nextOperation
+	case s.num.Is:
+		return s, s.clr("%swav index must be between 0 and%s %d", italic, reset, len(s.wmap)-1)
+	case assigned:
+		return s, nextOperation
+	}
+	return checkWav(s)
+}
+
 func enactMute(s systemState) (systemState, int) {
 	i, ok := parseIndex(s.listingState, len(mutes))
 	if !ok || excludeCurrent(s.operator, i, len(mutes)) {
@@ -2266,6 +4199,28 @@ func enactMute(s systemState) (systemState, int) {
 	return s, startNewOperation
 }
 
+func enactBypass(s systemState) (systemState, int) {
+	i, ok := parseIndex(s.listingState, len(bypassed))
+	if !ok || excludeCurrent(s.operator, i, len(bypassed)) {
+		return s, startNewOperation // error reported by parseIndex
+	}
+	bypassed[i] = !bypassed[i]
+	state := "resumed"
+	if bypassed[i] {
+		state = "bypassed"
+	}
+	go func(before time.Duration) { // report change in load once the listing has faded
+		time.Sleep(300 * time.Millisecond)
+		period := 1e9 / s.sampleRate
+		msg("%slisting %d %s, load%s %.2f %s→%s %.2f", italic, i, state, reset,
+			float64(before)/period, italic, reset, float64(display.Load)/period)
+	}(display.Load)
+	if s.operator[:1] == "." && len(s.newListing) > 0 {
+		tokens <- token{"mix", -1, not}
+	}
+	return s, startNewOperation
+}
+
 func enactSolo(s systemState) (systemState, int) {
 	i, ok := parseIndex(s.listingState, len(mutes))
 	if !ok {
@@ -2301,6 +4256,10 @@ func enactSolo(s systemState) (systemState, int) {
 }
 
 func beginFunctionDefine(s systemState) (systemState, int) {
+	if s.operand == "Version" { // reserved in functions.json
+		msg("%s%s is reserved, use another name%s", italic, s.operand, reset)
+		return s, startNewOperation
+	}
 	if _, ok := s.funcs[s.operand]; ok {
 		msg("%swill overwrite existing function!%s", red, reset)
 	} else if _, ok := s.hasOperand[s.operand]; ok { // using this map to avoid cyclic reference of operators
@@ -2326,6 +4285,38 @@ func doLoop(s systemState) (systemState, int) {
 	return s, startNewOperation
 }
 
+// help shows the doc of an operator or comment of a function in the info display,
+// or for `l` prints all operators with their docs to the terminal
+func help(op string, s systemState) {
+	if op == "l" {
+		names := make([]string, 0, len(s.docs))
+		for name, doc := range s.docs {
+			if doc != "" && name != "deleted" {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			pf("%s%-10s%s%s\n", italic, name, reset, s.docs[name])
+		}
+		msg("%s%d operators listed in terminal%s", italic, len(names), reset)
+		return
+	}
+	if doc := s.docs[op]; doc != "" {
+		operand := "no operand"
+		if s.hasOperand[op] {
+			operand = "takes operand"
+		}
+		msg("%s%s%s %s, %s%s%s", italic, op, reset, doc, italic, operand, reset)
+		return
+	}
+	if f, in := s.funcs[op]; in {
+		msg("%s%s%s %s, %sfunction%s", italic, op, reset, f.Comment, italic, reset)
+		return
+	}
+	msg("%sno help for%s %s", italic, reset, op)
+}
+
 func modeSet(s systemState) (systemState, int) {
 	if s.operand == "p" { // toggle pause/play
 		switch {
@@ -2337,22 +4328,7 @@ func modeSet(s systemState) (systemState, int) {
 	}
 	switch s.operand {
 	case "exit", "q":
-		p("\nexiting...")
-		exit = yes
-		if display.Paused {
-			<-pause
-		}
-		if started {
-			<-stop // received when shutdown complete
-		} else {
-			close(stop)
-		}
-		saveJson([]listing{{operation{Op: advisory}}}, "displaylisting.json")
-		p("Stopped")
-		if s.funcsave && !saveJson(s.funcs, "functions.json") {
-			msg("functions not saved!")
-		}
-		time.Sleep(30 * time.Millisecond) // wait for infoDisplay to finish
+		shutdown(s)
 		return s, exitNow
 	case "erase", "e":
 		return s, startNewListing
@@ -2362,7 +4338,7 @@ func modeSet(s systemState) (systemState, int) {
 	case "fon":
 		s.funcsave = yes
 		display.Mode = "on"
-		if !saveJson(s.funcs, "functions.json") {
+		if !saveFunctions(s.funcs) {
 			msg("functions not saved!")
 			return s, startNewOperation
 		}
@@ -2370,13 +4346,16 @@ func modeSet(s systemState) (systemState, int) {
 	case "pause":
 		if started && !display.Paused {
 			pause <- yes // bool is purely semantic
-			display.Paused = yes
+			display.Paused, staged = yes, not
 		}
 	case "play":
 		if !display.Paused {
 			return s, startNewOperation
 		}
-		<-pause
+		staged = not
+		if started { // otherwise the sound engine is waiting for the first listing
+			<-pause
+		}
 		display.Paused = not
 	case "clear", "c":
 		msg("clear")
@@ -2416,18 +4395,223 @@ func modeSet(s systemState) (systemState, int) {
 		msg("Live: %v", stats.Mallocs-stats.Frees)
 	case "mc": // mouse curve, exp or lin
 		mouse.mc = !mouse.mc
-	case "rs": // root sync, is this needed any more?
+		savePrefs()
+	case "mousegain", "mousebase": // sensitivity and base of exponential curve, eg. `: mousegain 0.5`
+		a, ok := modeArg()
+		if !ok {
+			msg("%smousegain is%s %.3g%s, mousebase is%s %.3g", italic, reset, mouse.gain, italic, reset, mouse.base)
+			return s, startNewOperation
+		}
+		v, ok := evaluateExpr(a)
+		if !ok || !validMouse(s.operand, v) {
+			msg("%s%s out of range:%s %s", italic, s.operand, reset, a)
+			return s, startNewOperation
+		}
+		if s.operand == "mousegain" {
+			mouse.gain = v
+		} else {
+			mouse.base = v
+		}
+		savePrefs()
+		msg("%s%s set to%s %.3g", italic, s.operand, reset, v)
+	case "rs": // root sync
+		if syncHost == "" {
+			msg("%snot following a root instance, start with%s --sync-to host", italic, reset)
+			return s, startNewOperation
+		}
 		rs = yes
 		msg("%snext launch will sync to root instance%s", italic, reset)
 	case "reset":
 		rst = !rst
 		msg("reset: %t", rst)
+	case "recall": // list recent launches
+		s.operand = ""
+		return recall(s)
+	case "help": // operator reference, eg. `: help mul`, `: help l` lists all
+		a, ok := modeArg()
+		if !ok {
+			return s, startNewOperation
+		}
+		help(a, s)
+	case "export": // write listing to named file, eg. `: export 2 bassline`
+		return exportListing(s)
+	case "overlap": // of fft frames, eg. `: overlap 4`
+		a, ok := modeArg()
+		if !ok {
+			return s, startNewOperation
+		}
+		switch a {
+		case "2", "4", "8":
+			overlap, _ = strconv.Atoi(a)
+			msg("%sfft overlap set to%s %s%s, for subsequent launches%s", italic, reset, a, italic, reset)
+		default:
+			msg("%soverlap must be 2, 4 or 8%s", italic, reset)
+		}
+	case "master": // `: master bypass` toggles the limiter, for comparison. Output is still clipped
+		a, ok := modeArg()
+		if !ok {
+			return s, startNewOperation
+		}
+		if a != "bypass" {
+			msg("%smaster settings are:%s bypass", italic, reset)
+			return s, startNewOperation
+		}
+		masterBypass = !masterBypass
+		display.Bypass = masterBypass
+		if masterBypass {
+			msg("%smaster limiter bypassed, output will clip%s", italic, reset)
+			break
+		}
+		msg("%smaster limiter on%s", italic, reset)
+	case "limiter": // eg. `: limiter attack 5ms`, release is set by the `release` operator
+		a, ok := modeArg()
+		if !ok {
+			return s, startNewOperation
+		}
+		if a != "attack" {
+			msg("%slimiter settings are:%s attack", italic, reset)
+			return s, startNewOperation
+		}
+		if a, ok = modeArg(); !ok {
+			return s, startNewOperation
+		}
+		if a == "0" {
+			limAttack = 1
+			savePrefs()
+			msg("%slimiter attack set to instant%s", italic, reset)
+			break
+		}
+		n, ok := parseType(a, "limiter")
+		if !ok || n <= 0 {
+			msg("%slimiter attack requires a time, eg.%s 5ms", italic, reset)
+			return s, startNewOperation
+		}
+		limAttack = math.Min(1, n)
+		savePrefs()
+		msg("%slimiter attack set to%s %.3gms", italic, reset, 1e3/(limAttack*s.sampleRate))
+	case "usage": // most used operators and functions, and unused functions
+		showUsage(s.usage, s)
+	case "printrate": // interval of print output, eg. `: printrate 100ms`
+		a, ok := modeArg()
+		if !ok {
+			return s, startNewOperation
+		}
+		n, ok := parseType(a, "printrate")
+		if !ok || n <= 0 || n > 1/(minPrintInterval*s.sampleRate) {
+			msg("%sprintrate requires a time of at least 1ms, eg.%s 100ms", italic, reset)
+			return s, startNewOperation
+		}
+		printInterval, printJitter = int(1/n), not
+		msg("%sprint interval set to%s %.3gms", italic, reset, 1e3/(n*s.sampleRate))
+	case "printlog": // toggle print output to info log
+		if !writeLog {
+			msg("%sstart with%s --log %sto log print%s", italic, reset, italic, reset)
+			return s, startNewOperation
+		}
+		printLog = !printLog
+		if printLog {
+			msg("%sprint output to%s info.log", italic, reset)
+			break
+		}
+		msg("%sprint output to info display%s", italic, reset)
+	case "snapshot": // save signals of a listing, eg. `: snapshot 2`
+		return snapshotListing(s)
+	case "restore": // signals saved by snapshot, eg. `: restore 2`
+		return restoreListing(s)
+	case "compact": // remove deleted listings and renumber
+		return compactListings(s)
+	case "stress": // load of n more listings, eg. `: stress 20`
+		return stressTest(s)
+	case "rewav": // load wavs added since start
+		return rewav(s)
+	case "quantise", "quantize": // launch on the next beat, eg. `: quantise on` or every 4 beats `: quantise 4`
+		a, ok := modeArg()
+		switch n, rr := strconv.ParseFloat(a, 64); {
+		case !ok:
+			msg("%squantise is%s %g %sbeats, 0 for off%s", italic, reset, quantum, italic, reset)
+			return s, startNewOperation
+		case a == "on":
+			quantum = 1
+		case a == "off":
+			quantum = 0
+		case e(rr) || !(n > 0) || math.IsInf(n, 0): // NaN fails n > 0
+			msg("%squantise requires on, off or a number of beats%s", italic, reset)
+			return s, startNewOperation
+		default:
+			quantum = n
+		}
+		msg("%squantise:%s %g %sbeats%s", italic, reset, quantum, italic, reset)
+	case "rewind": // transport position to zero
+		rewind = yes
+		msg("%stransport rewound%s", italic, reset)
+	case "autogain": // gain follows output level slowly, eg. `: autogain on`
+		a, ok := modeArg()
+		if !ok {
+			return s, startNewOperation
+		}
+		switch a {
+		case "on":
+			autoGain = yes
+		case "off":
+			autoGain = not
+		default:
+			msg("%s %snot on or off%s", a, italic, reset)
+			return s, startNewOperation
+		}
+		msg("%sautogain %s%s", italic, a, reset)
+	case "muff": // toggle skipping of muted listings, for feedback patches that need to keep running
+		muteSkip = !muteSkip
+		if muteSkip {
+			msg("%smuted listings skipped%s", italic, reset)
+			break
+		}
+		msg("%smuted listings keep running%s", italic, reset)
+	case "levelsmooth": // smoothing time of level, eg. `: levelsmooth 20ms`
+		a, ok := modeArg()
+		if !ok {
+			return s, startNewOperation
+		}
+		if a == "0" {
+			levelTime = 0
+			msg("%slevel smoothing off%s", italic, reset)
+			break
+		}
+		n, ok := parseType(a, "levelsmooth")
+		if !ok || n <= 0 {
+			msg("%slevelsmooth requires a time, eg.%s 20ms", italic, reset)
+			return s, startNewOperation
+		}
+		levelTime = math.Min(1/(n*s.sampleRate), 1)
+		msg("%slevel smoothing set to%s %.3gms", italic, reset, levelTime*1e3)
+	case "width": // stereo width, eg. `: width 0.5`
+		a, ok := modeArg()
+		if !ok {
+			msg("%swidth is%s %.2f", italic, reset, stereoWidth)
+			return s, startNewOperation
+		}
+		w, ok := evaluateExpr(a)
+		if !ok {
+			msg("%swidth not a number:%s %s", italic, reset, a)
+			return s, startNewOperation
+		}
+		stereoWidth = math.Max(0, math.Min(maxWidth, w))
+		savePrefs()
+		msg("%swidth set to%s %.2f", italic, reset, stereoWidth)
 	default:
 		msg("%sunrecognised mode: %s%s", italic, reset, s.operand)
 	}
 	return s, startNewOperation
 }
 
+// modeArg reads the next token as an argument to a mode command
+func modeArg() (string, bool) {
+	a := strings.TrimSuffix((<-tokens).tk, ",")
+	if a == "_" || a == "" {
+		return "", not
+	}
+	return a, yes
+}
+
 func enactDelete(s systemState) (systemState, int) {
 	n, ok := parseIndex(s.listingState, len(s.dispListings))
 	if !ok || excludeCurrent(s.operator, n, len(s.dispListings)) {
@@ -2542,11 +4726,28 @@ func adjustGain(s systemState) (systemState, int) {
 	return s, startNewOperation
 }
 
+const (
+	minClipThr = 1    // master limiter threshold, lower would limit twice
+	maxClipThr = 63.1 // +36dB
+)
+
+// adjustClip sets the threshold of the individual listing limiters, eg. `ct 2` or `ct 6db`
 func adjustClip(s systemState) (systemState, int) {
-	if n, ok := parseType(s.operand, s.operator); ok { // permissive, no bounds check
-		clipThr = n
-		msg("%sclip threshold set to %.3g%s", italic, clipThr, reset)
+	if s.operand == "is" {
+		msg("%sclip threshold is%s %.3g (%.2gdb)", italic, reset, clipThr, 20*math.Log10(clipThr))
+		return s, startNewOperation
+	}
+	n, ok := parseType(s.operand, s.operator)
+	if !ok { // error reported by parseType
+		return s, startNewOperation
+	}
+	if n < minClipThr || n > maxClipThr {
+		msg("%sclip threshold must be between%s %d %sand%s %.3g (0db to 36db)",
+			italic, reset, minClipThr, italic, reset, maxClipThr)
+		return s, startNewOperation
 	}
+	clipThr = n
+	msg("%sclip threshold set to%s %.3g (%.2gdb)", italic, reset, clipThr, 20*math.Log10(clipThr))
 	return s, startNewOperation
 }
 
@@ -2569,13 +4770,44 @@ func checkAlp(s systemState) (systemState, int) {
 }
 
 func enactWait(s systemState) (systemState, int) {
-	if t, ok := parseType(s.operand, s.operator); ok { // permissive, no bounds check
-		pf("%swaiting...%s\n\t", italic, reset)
-		time.Sleep(time.Second * 1e3 / time.Duration(t * s.sampleRate * 1e3))
+	t, ok := waitDuration(s.operand)
+	if !ok {
+		return s, startNewOperation // error reported by waitDuration
+	}
+	pf("%swaiting...%s\n\t", italic, reset)
+	select {
+	case <-time.After(t):
+	case <-cancelWait:
+		msg("%swait cancelled%s", italic, reset)
 	}
 	return s, startNewOperation
 }
 
+// waitDuration converts a time operand to a duration. Plain numbers are taken as seconds
+func waitDuration(opd string) (time.Duration, bool) {
+	if opd == "" {
+		msg("%sno time given%s", italic, reset)
+		return 0, not
+	}
+	if unicode.IsDigit(rune(opd[len(opd)-1])) || opd[len(opd)-1] == '.' {
+		n, ok := evaluateExpr(opd)
+		if !ok || n < 0 {
+			msg("%s %snot a valid time%s", opd, italic, reset)
+			return 0, not
+		}
+		return time.Duration(n * float64(time.Second)), yes
+	}
+	n, ok := parseType(opd, "wait")
+	if !ok {
+		return 0, not // parseType will report error
+	}
+	if n <= 0 {
+		msg("%s %snot a valid time%s", opd, italic, reset)
+		return 0, not
+	}
+	return time.Duration(float64(time.Second) / (n * SampleRate)), yes
+}
+
 func isUppercaseInitialOrDefaultExported(operand string) bool {
 	switch operand {
 	case "dac", "tempo", "pitch", "grid", "sync": // needs to include wav signals
@@ -2611,9 +4843,35 @@ func newSystemState(sc soundcard) (systemState, [][]float64, wavs) {
 	}
 
 	loadFunctions(&t.funcs)
+	cyclic := []string{}
+	for name, f := range t.funcs { // expanding these would never end
+		if op, ok := functionCycle(name, f.Body, t.funcs, map[string]bool{}); ok {
+			pf("function %s refers to itself through %s, not loaded\n", name, op)
+			cyclic = append(cyclic, name)
+		}
+	}
+	for _, name := range cyclic {
+		delete(t.funcs, name)
+	}
+	for unknown := yes; unknown; { // remove those left referring to removed functions
+		unknown = not
+		for name, f := range t.funcs {
+			for _, o := range f.Body {
+				_, isOperator := operators[o.Op]
+				if _, isFunction := t.funcs[o.Op]; !isOperator && !isFunction {
+					pf("function %s refers to unknown %s, not loaded\n", name, o.Op)
+					delete(t.funcs, name)
+					unknown = yes
+					break
+				}
+			}
+		}
+	}
 	t.hasOperand = make(map[string]bool, len(operators)+len(t.funcs))
+	t.docs = make(map[string]string, len(operators))
 	for k, o := range operators {
 		t.hasOperand[k] = o.Opd
+		t.docs[k] = o.doc
 	}
 	for k, f := range t.funcs {
 		h := not
@@ -2628,15 +4886,48 @@ func newSystemState(sc soundcard) (systemState, [][]float64, wavs) {
 
 	// process wavs
 	wavSlice := decodeWavs()
-	wavs := make([][]float64, 0, len(wavSlice))
 	t.wmap = map[string]bool{}
 	for _, w := range wavSlice {
 		t.wavNames += w.Name + " "
 		t.wmap[w.Name] = yes
+	}
+	t.wavSlice = wavSlice
+
+	return t, wavData(wavSlice), wavSlice
+}
+
+func wavData(wavSlice wavs) [][]float64 {
+	wavs := make([][]float64, 0, len(wavSlice))
+	for _, w := range wavSlice {
 		wavs = append(wavs, w.Data)
 	}
+	return wavs
+}
 
-	return t, wavs, wavSlice
+// rewav decodes wavs again, adding those not yet loaded after the others so
+// that running listings keep their indices. Loaded wavs are not replaced
+func rewav(s systemState) (systemState, int) {
+	added := ""
+	for _, w := range decodeWavs() {
+		if s.wmap[w.Name] {
+			continue
+		}
+		s.wavSlice = append(s.wavSlice, w)
+		s.wmap[w.Name] = yes
+		s.wavNames += w.Name + " "
+		added += w.Name + " "
+	}
+	if added == "" {
+		msg("%sno new wavs%s", italic, reset)
+		return s, startNewOperation
+	}
+	select { // not yet received if the sound engine hasn't started
+	case <-wavBank:
+	default:
+	}
+	wavBank <- wavData(s.wavSlice)
+	msg("%sadded:%s %s", italic, reset, added)
+	return s, startNewOperation
 }
 
 func initialiseListing(t systemState) systemState {
@@ -2657,6 +4948,12 @@ func initialiseListing(t systemState) systemState {
 		"butt2",
 		"grid",
 		"sync",
+		"inL", // soundcard input, see --input
+		"inR",
+		"beat", // transport position, see `: rewind`
+		"pressure", // graphics tablet, see --tablet
+		"tiltx",
+		"tilty",
 	}
 	for _, name := range res {
 		t.createListing = addSignal(t.createListing, name, 0)
@@ -2694,6 +4991,17 @@ func initialiseListing(t systemState) systemState {
 	return t
 }
 
+// addWavSignals adds the index and playback rate of each wav as named signals
+func addWavSignals(t createListing, wavSlice wavs) createListing {
+	for i, w := range wavSlice {
+		t = addSignal(t, w.Name, float64(i))
+		rate := 1.0 / float64(len(w.Data))
+		name := "r."+w.Name
+		t = addSignal(t, name, rate)
+	}
+	return t
+}
+
 func addSignal(t createListing, name string, val float64) createListing {
 	if _, in := t.signals[name]; in {
 		return t
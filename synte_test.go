@@ -1,8 +1,16 @@
 package main
 
 import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"math/cmplx"
+	"os"
 	"slices"
+	"strings"
 	"testing"
+	"time"
 )
 
 func init() {
@@ -31,19 +39,24 @@ var testChecks = []struct {
 	{check: checkOut, name: "checkOut", op: "out", opd: "vca", o: nextOperation},
 	{check: checkOut, name: "checkOut", op: "out", opd: "3hz", o: startNewOperation, num: true},
 	{check: checkOut, name: "checkOut", op: "out+", opd: "extant", o: nextOperation},
+	{check: checkOut, name: "checkOut", op: "out-", opd: "extant", o: startNewOperation}, // no prior out
 	{check: checkOut, name: "checkOut", op: "out", opd: "^freq", o: nextOperation},
 	{check: checkOut, name: "checkOut", op: "out", opd: "extant", o: startNewOperation},
 	{check: checkOut, name: "checkOut", op: "out", opd: "@", o: startNewOperation},
 	{check: checkIndexIncl, name: "checkIndexIncl", op: "level", opd: "0", o: nextOperation, num: true},
 	{check: checkIndexIncl, name: "checkIndexIncl", op: "level", opd: "Z", o: startNewOperation},
+	{check: checkIndexIncl, name: "checkIndexIncl", op: "level", opd: "1", o: nextOperation, num: true}, // itself
+	{check: checkIndexIncl, name: "checkIndexIncl", op: "pan", opd: "1", o: nextOperation, num: true},
 	{check: checkIndexIncl, name: "checkIndexIncl", op: "level", opd: "2", o: startNewOperation},
 	{check: checkIndex, name: "checkIndex", op: "from", opd: "0", o: nextOperation, num: true},
 	{check: checkIndex, name: "checkIndex", op: "from", opd: "Z", o: startNewOperation},
-	{check: checkIndex, name: "checkIndex", op: "from", opd: "1", o: startNewOperation},
+	{check: checkIndex, name: "checkIndex", op: "from", opd: "1", o: startNewOperation}, // itself
 	{check: checkFade, name: "checkFade", op: "fade", opd: "Z", o: startNewOperation, num: false},
 	{check: checkFade, name: "checkFade", op: "fade", opd: "125ms", o: startNewOperation, num: true},
 	{check: checkRelease, name: "checkRelease", op: "release", opd: "125ms", o: startNewOperation, num: true},
 	{check: checkRelease, name: "checkRelease", op: "release", opd: "Z", o: startNewOperation, num: false},
+	{check: checkBias, name: "checkBias", op: "bias", opd: "3db", o: nextOperation, num: true},
+	{check: checkBias, name: "checkBias", op: "bias", opd: "vca", o: startNewOperation, num: false},
 }
 
 func TestChecks(t *testing.T) {
@@ -92,6 +105,18 @@ func TestParseType(t *testing.T) {
 		{"in", "48*2e3hz", 0, false},
 		{"in", "0db", 1, true},
 		{"in", "1*+-3x", 0, false},
+		{"in", "3/2", 1.5, true},
+		{"in", "5e-1-2.5e-1", 0.25, true},
+		{"in", "-2.5e-1+1", 0.75, true},
+		{"in", "1+2*3", 7, true},
+		{"in", "(1+2)*3", 9, true},
+		{"in", "-(1/4)", -0.25, true},
+		{"in", "2*-3", -6, true},
+		{"in", "1/2/2", 0.25, true},
+		{"in", "1/4e1hz", 1.0 / 40 / SampleRate, true},
+		{"in", "(1+2", 0, false},
+		{"in", "1+", 0, false},
+		{"in", "1e", 0, false},
 	}
 	for _, tst := range tests {
 		if n, b := parseType(tst.expr, tst.op); n != tst.n || b != tst.b {
@@ -153,3 +178,1422 @@ func TestEndFunctionDefine(t *testing.T) {
 		t.Log(s.hasOperand)
 	}
 }
+
+func TestSuggest(t *testing.T) {
+	names := map[string]bool{"mul": true, "mod": true, "out": true, "out+": true, "sine": true, "sino": true}
+	tests := []struct {
+		op   string
+		want []string
+	}{
+		{"mull", []string{"mul"}},
+		{"siin", []string{"sine", "sino"}},
+		{"ot", []string{"out"}},
+		{"zzzzzz", []string{}},
+	}
+	for _, tst := range tests {
+		if s := suggest(tst.op, names); !slices.Equal(s, tst.want) {
+			t.Errorf(`suggest(%q) => %v, expected %v`, tst.op, s, tst.want)
+		}
+	}
+}
+
+func TestEnactWait(t *testing.T) {
+	var s systemState
+	s.operand = "100ms"
+	start := time.Now()
+	if _, res := enactWait(s); res != startNewOperation {
+		t.Errorf(`enactWait(%q) => %s, expected startNewOperation`, s.operand, results[res])
+	}
+	if d := time.Since(start); d < 95*time.Millisecond { // no upper bound, a loaded machine may oversleep
+		t.Errorf(`enactWait(%q) slept %v, expected at least 100ms`, s.operand, d)
+	}
+	for _, opd := range []string{"0.1", "1/10", "100ms", "10hz"} {
+		if d, ok := waitDuration(opd); !ok || d != 100*time.Millisecond {
+			t.Errorf(`waitDuration(%q) => %v %v, expected 100ms true`, opd, d, ok)
+		}
+	}
+}
+
+// readmeExamples extracts the fenced code blocks tagged `syt` from README.md
+func readmeExamples(t *testing.T) []string {
+	t.Helper()
+	f, err := os.ReadFile("README.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var examples []string
+	var b strings.Builder
+	in := false
+	for _, line := range strings.Split(string(f), "\n") {
+		switch l := strings.TrimSpace(line); {
+		case !in && l == "```syt":
+			in = true
+			b.Reset()
+		case in && l == "```":
+			in = false
+			examples = append(examples, b.String())
+		case in:
+			b.WriteString(l + "\n")
+		}
+	}
+	return examples
+}
+
+func TestReadmeExamples(t *testing.T) {
+	examples := readmeExamples(t)
+	if len(examples) == 0 {
+		t.Fatal(`no examples found in README.md`)
+	}
+	s, _, _ := newSystemState(soundcard{sampleRate: SampleRate})
+	s.wmap["local"] = true
+	usage := map[string]int{}
+	for i, ex := range examples {
+		s = initialiseListing(s)
+		var rr string
+		s.clr = func(m string, i ...interface{}) int {
+			rr = sf(m, i...)
+			return startNewListing
+		}
+		for _, tk := range strings.Fields(strings.ReplaceAll(ex, "[name of wav file]", "local")) {
+			tokens <- token{tk, -1, true}
+		}
+		tokens <- token{"_", -1, true} // ends input if listing is incomplete
+		ldExt := true
+		var res int
+		s, res = inputListing(s, &ldExt, usage)
+		emptyTokens()
+		if res != nextOperation {
+			t.Errorf("example #%d => %s %s, expected nextOperation\n%s", i, results[res], rr, ex)
+		}
+	}
+}
+
+func TestEngine(t *testing.T) {
+	eng := New(SampleRate)
+	defer eng.Close()
+	if err := eng.Launch("in 330hz osc sine mul 0.5 out dac"); err != nil {
+		t.Fatal(err)
+	}
+	if err := eng.Launch("in 330hz osc sine"); err == nil {
+		t.Error(`Launch(incomplete) => nil, expected error`)
+	}
+	buf := eng.Render(9600)
+	if len(buf) != 2*9600 {
+		t.Fatalf(`Render(9600) => %d samples, expected %d`, len(buf), 2*9600)
+	}
+	peak := 0.0
+	for _, s := range buf[2*7200:] { // skip fade-in
+		peak = math.Max(peak, math.Abs(s))
+	}
+	if peak < 0.1 || peak > 1 {
+		t.Errorf(`Render(9600) peak => %.3g, expected a sine tone`, peak)
+	}
+}
+
+func TestLaunchWithoutRender(t *testing.T) {
+	eng := New(SampleRate)
+	defer eng.Close()
+	if err := eng.Launch("in 330hz osc sine mul 0.5 out dac"); err != nil {
+		t.Fatal(err)
+	}
+	eng.Render(480)
+	time.Sleep(200 * time.Millisecond) // sound engine fills output and waits on Render
+	done := make(chan error)
+	go func() {
+		done <- eng.Launch("in 440hz osc sine mul 0.5 out dac")
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal(`Launch() without Render blocked`)
+	}
+}
+
+func TestSplitSet(t *testing.T) {
+	var s systemState
+	s.hasOperand = map[string]bool{"in": yes, "out": yes}
+	s.funcs = map[string]fn{"mix": {Body: listing{{Op: "out", Opd: "dac"}}}}
+	set := splitSet(strings.NewReader("in 330hz\nout dac\n---\n\n---\n\tin 2hz\n\tmix\n---\nin 3hz\n"))
+	if len(set) != 3 {
+		t.Fatalf(`splitSet() => %d listings, expected 3: %q`, len(set), set)
+	}
+	for i, end := range []bool{yes, yes, not} {
+		if endsListing(set[i], s) != end {
+			t.Errorf(`endsListing(%q) => %v, expected %v`, set[i], !end, end)
+		}
+	}
+	if set := splitSet(strings.NewReader("in 330hz\n\nmix\n")); len(set) != 1 || len(set[0]) != 3 {
+		t.Errorf(`splitSet(single) => %q, expected one listing`, set)
+	}
+}
+
+func TestPulse(t *testing.T) {
+	defer func(sr float64) { SampleRate = sr }(SampleRate)
+	for _, sr := range []float64{44100, 48000, 96000} {
+		SampleRate = sr
+		f, ok := parseType("7hz", "pulse@")
+		if !ok {
+			t.Fatalf(`parseType("7hz") at %gHz failed`, sr)
+		}
+		ph, n, prev := 0.0, 0, 0.0
+		for i := 0; i < int(sr*3.5); i++ {
+			p := pulse(&ph, f)
+			if p == 1 && prev == 1 {
+				t.Fatalf(`pulse() at %gHz => wider than one sample at %d`, sr, i)
+			}
+			n += int(p)
+			prev = p
+		}
+		if n != 24 {
+			t.Errorf(`pulse(7hz) at %gHz => %d pulses in 3.5s, expected 24`, sr, n)
+		}
+	}
+}
+
+func TestTrig(t *testing.T) {
+	for _, rising := range []bool{true, false} {
+		prev, last, n := 0.0, 0.0, 0
+		for i := 0; i < 48000; i++ {
+			x := math.Sin(Tau * (float64(i) + 0.5) * 10 / 48000) // 10 cycles, first sample rises from zero
+			p := trig(&last, x, rising)
+			if p == 1 && prev == 1 {
+				t.Fatalf(`trig(rising: %v) => wider than one sample at %d`, rising, i)
+			}
+			if p == 1 && (x > 0) != rising {
+				t.Errorf(`trig(rising: %v) => pulse at %d on wrong edge`, rising, i)
+			}
+			n += int(p)
+			prev = p
+		}
+		if n != 10 {
+			t.Errorf(`trig(rising: %v) => %d pulses, expected 10`, rising, n)
+		}
+	}
+}
+
+func TestDivide(t *testing.T) {
+	var v divider
+	got := ""
+	for i, n := range []float64{4, 4, 4, 4, 4, 4, 2, 2, 2, 2, 3, 3, 3} { // divisor at each trigger
+		v.divide(0, n)
+		if v.divide(1, n) == 1 {
+			got += sf("%d ", i)
+		}
+		if v.divide(1, n) == 1 {
+			t.Fatalf(`divide() => wider than one sample at trigger %d`, i)
+		}
+	}
+	if expected := "0 4 6 8 11 "; got != expected {
+		t.Errorf(`divide() => pulses at triggers %s, expected %s`, got, expected)
+	}
+}
+
+func TestEuclidean(t *testing.T) {
+	for _, c := range []struct {
+		hits, steps float64
+		expected    string
+	}{
+		{3, 8, "x..x..x.x..x..x."},
+		{5, 8, "x.x.xx.xx.x.xx.x"}, // a rotation of x.xx.xx.
+		{0, 4, "........"},
+		{9, 4, "xxxxxxxx"},
+	} {
+		u := euclidean{steps: c.steps}
+		got := ""
+		for i := 0; i < int(c.steps)*2; i++ {
+			u.hit(0, c.hits)
+			switch u.hit(1, c.hits) {
+			case 1:
+				got += "x"
+			default:
+				got += "."
+			}
+		}
+		if got != c.expected {
+			t.Errorf(`euclidean(%v,%v) => %s, expected %s`, c.hits, c.steps, got, c.expected)
+		}
+	}
+}
+
+func TestChance(t *testing.T) {
+	no := noise(88172645463325252)
+	for _, p := range []float64{0, 0.5, 1} {
+		var g gate
+		passed := 0
+		for i := 0; i < 1000; i++ {
+			g.chance(0, p, 0)
+			first := g.chance(1, p, (no.ise()+1)*0.5)
+			for j := 0; j < 10; j++ { // gate held open
+				if g.chance(1, p, (no.ise()+1)*0.5) != first {
+					t.Fatalf(`chance(%v) => changed while gate held open`, p)
+				}
+			}
+			passed += int(first)
+		}
+		switch {
+		case p == 0 && passed != 0, p == 1 && passed != 1000, p == 0.5 && (passed < 400 || passed > 600):
+			t.Errorf(`chance(%v) => %d of 1000 passed`, p, passed)
+		}
+	}
+}
+
+func TestSequence(t *testing.T) {
+	for _, c := range []struct {
+		opd      string
+		expected []float64
+	}{
+		{"1,2,3", []float64{1, 2, 3, 1, 2}}, // wraps
+		{"0.5", []float64{0.5, 0.5, 0.5}},
+	} {
+		v, ok := parseSeq(c.opd)
+		if !ok {
+			t.Fatalf(`parseSeq(%s) => not ok`, c.opd)
+		}
+		q := sequence{vals: v, v: v[0]}
+		for i, expected := range c.expected {
+			q.next(0)
+			if got := q.next(1); got != expected {
+				t.Errorf(`seq %s, step %d => %v, expected %v`, c.opd, i, got, expected)
+			}
+			if got := q.next(1); got != expected {
+				t.Errorf(`seq %s, step %d => %v held, expected %v`, c.opd, i, got, expected)
+			}
+		}
+	}
+	if _, ok := parseSeq("1,,2"); ok {
+		t.Error(`parseSeq(1,,2) => ok, expected empty value rejected`)
+	}
+}
+
+func TestSine(t *testing.T) {
+	defer calcSineTab(SampleRate)
+	for _, sr := range []float64{44100, 48000, 96000} {
+		calcSineTab(sr)
+		for i := -100000; i <= 100000; i++ {
+			x := float64(i) * 1.37e-4
+			if d := math.Abs(sine(x) - math.Cos(Tau*x)); d > 1e-8 {
+				t.Fatalf(`sine(%g) at %gHz => error %g, expected < 1e-8`, x, sr, d)
+			}
+		}
+	}
+	if !math.IsNaN(sine(math.Inf(1))) || !math.IsNaN(sine(math.NaN())) {
+		t.Error(`sine(Inf, NaN) => expected NaN`)
+	}
+}
+
+func TestTanh(t *testing.T) {
+	defer calcTanhTab(defaultTanhBits)
+	for _, bits := range []int{minTanhBits, 12, defaultTanhBits, maxTanhBits} {
+		calcTanhTab(bits)
+		worst := 0.0
+		for i := -100000; i <= 100000; i++ {
+			x := float64(i) * 1.37e-5
+			worst = math.Max(worst, math.Abs(tanh(x)-math.Tanh(x)))
+		}
+		bound := 0.1/math.Pow(4, float64(bits)) + 1e-15
+		t.Logf(`%d bits, %dKB: error %.3g`, bits, len(tanhTab)*8>>10, worst)
+		if worst > bound {
+			t.Errorf(`tanh with %d bit table => error %.3g, expected < %.3g`, bits, worst, bound)
+		}
+	}
+	if tanh(1) != math.Tanh(1) || !math.IsNaN(tanh(math.NaN())) {
+		t.Error(`tanh(1, NaN) => expected math.Tanh`)
+	}
+}
+
+var sink float64
+
+func BenchmarkTanh(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		sink += tanh(float64(i%200000-100000) * 1e-5)
+	}
+}
+
+func BenchmarkSine(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		sink += sine(float64(i) * 1.37e-4)
+	}
+}
+
+func BenchmarkCos(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		sink += math.Cos(Tau * float64(i) * 1.37e-4)
+	}
+}
+
+func TestCompGain(t *testing.T) {
+	thr := 0.25 // -12dB
+	tests := []struct {
+		env, ratio, g float64
+	}{
+		{0.1, 4, 1}, // below threshold
+		{thr, 4, 1},
+		{4 * thr, 4, math.Pow(4, -0.75)}, // +12dB over => +3dB out
+		{4 * thr, 2, 0.5},                // +12dB over => +6dB out
+		{4 * thr, 1, 1},                  // no compression
+	}
+	for _, tst := range tests {
+		if g := compGain(tst.env, thr, tst.ratio); math.Abs(g-tst.g) > 1e-12 {
+			t.Errorf(`compGain(%g, %g, %g) => %g, expected %g`, tst.env, thr, tst.ratio, g, tst.g)
+		}
+	}
+	c := compressor{ratio: 2, att: 1, rel: 1}
+	if y := c.compress(1, thr); math.Abs(y-0.5) > 1e-12 {
+		t.Errorf(`compress(1) with instant attack => %g, expected 0.5`, y)
+	}
+}
+
+func TestDuck(t *testing.T) {
+	c := compressor{ratio: 4, att: 1 / (5e-3 * 48000), rel: 1 / (200e-3 * 48000)}
+	for i := 0; i < 4800; i++ { // key at full scale for 100ms
+		c.duck(1, 1)
+	}
+	prev := c.duck(1, 1)
+	if prev > 0.1 {
+		t.Errorf(`duck() keyed at 0dB => gain %g, expected < 0.1`, prev)
+	}
+	for i := 0; i < 96000; i++ { // key deleted, releases over 2s
+		g := c.duck(1, 0)
+		if g < prev || g-prev > 1e-3 {
+			t.Fatalf(`duck() release at sample %d => gain %g from %g, expected smooth increase`, i, g, prev)
+		}
+		prev = g
+	}
+	if prev != 1 {
+		t.Errorf(`duck() released => gain %g, expected 1`, prev)
+	}
+}
+
+func TestPeak(t *testing.T) {
+	const sr = 48000.0
+	gain := math.Pow(10, 12.0/20) // 12db
+	tests := []struct {
+		f, g float64 // test frequency and expected gain
+	}{
+		{1000, gain}, // centre
+		{20, 1},
+		{20000, 1},
+	}
+	for _, tst := range tests {
+		b := biquad{g: gain, q: 2}
+		peak := 0.0
+		for i := 0; i < int(sr); i++ {
+			y := b.peak(sine(float64(i)*tst.f/sr), 1000/sr)
+			if i > int(sr)/2 { // settled
+				peak = math.Max(peak, math.Abs(y))
+			}
+		}
+		if math.Abs(peak-tst.g) > 0.02*tst.g {
+			t.Errorf(`peak(%ghz) centred at 1000hz => gain %.3f, expected %.3f`, tst.f, peak, tst.g)
+		}
+	}
+}
+
+func TestOnePerListing(t *testing.T) { // operators sharing one state in the listing
+	eng := New(SampleRate)
+	defer eng.Close()
+	if err := eng.Launch("in 0, out dac"); err != nil { // listing 0, to refer to
+		t.Fatal(err)
+	}
+	for _, f := range []string{"comp -12db,4,5ms,200ms", "peq 800hz,6db,2", "duck 0"} {
+		if err := eng.Launch("in 330hz osc sine, " + f + ", " + f + ", out dac"); err == nil {
+			t.Errorf(`Launch(%s twice) => nil, expected error`, f)
+		}
+		if err := eng.Launch("in 330hz osc sine, " + f + ", out dac"); err != nil {
+			t.Errorf(`Launch(%s) => %v, expected nil`, f, err)
+		}
+	}
+}
+
+func TestWrap(t *testing.T) {
+	tests := []struct {
+		x, y, w float64
+	}{
+		{0.25, 1, 0.25},
+		{-0.25, 1, 0.75},
+		{-1, 1, 0},
+		{-2.5, 2, 1.5},
+		{5, 2, 1},
+		{-1e-20, 1, 0},
+		{1, 0, 0},
+	}
+	for _, tst := range tests {
+		if w := wrap(tst.x, tst.y); math.Abs(w-tst.w) > 1e-12 {
+			t.Errorf(`wrap(%g, %g) => %g, expected %g`, tst.x, tst.y, w, tst.w)
+		}
+	}
+	for x := -10.0; x < 10; x += 0.01 {
+		if w := wrap(x, 3); w < 0 || w >= 3 {
+			t.Errorf(`wrap(%g, 3) => %g, expected in [0, 3)`, x, w)
+		}
+	}
+}
+
+func TestOscMessage(t *testing.T) {
+	m := oscMessage("/sync", 258)
+	expected := []byte{'/', 's', 'y', 'n', 'c', 0, 0, 0, ',', 'i', 0, 0, 0, 0, 1, 2}
+	if !slices.Equal(m, expected) {
+		t.Errorf(`oscMessage("/sync", 258) => %v, expected %v`, m, expected)
+	}
+}
+
+func TestReduce(t *testing.T) {
+	for _, f := range []float64{4, 0.25, 12e3 / 48e3} { // 4 samples, as fraction and as 12khz
+		var s reducer
+		for i := 1; i <= 40; i++ {
+			y := s.reduce(float64(i), f)
+			if expected := float64(i - i%4); math.Abs(y-expected) > 1e-9 {
+				t.Fatalf(`reduce(%d, %g) => %g, expected %g`, i, f, y, expected)
+			}
+		}
+	}
+}
+
+func TestGateSpectrum(t *testing.T) {
+	var z [N]complex128
+	for n := range z { // equal magnitudes, varying phase
+		z[n] = cmplx.Rect(100, Tau*float64(n)/N)
+	}
+	z[1] = cmplx.Rect(10, math.Pi/3)
+	zz := z
+	gateSpectrum(&zz, 1) // gate below 50
+	for n := range zz {
+		if kept := zz[n] != 0; kept != (n != 1) {
+			t.Fatalf(`gateSpectrum(1) bin %d with magnitude %g => kept %v`, n, cmplx.Abs(z[n]), kept)
+		}
+	}
+	zz = z
+	gateSpectrum(&zz, -1) // gate above 50
+	for n := range zz {
+		if kept := zz[n] != 0; kept != (n == 1) {
+			t.Fatalf(`gateSpectrum(-1) bin %d with magnitude %g => kept %v`, n, cmplx.Abs(z[n]), kept)
+		}
+	}
+}
+
+func TestTruncateSpectrum(t *testing.T) {
+	var y [N]complex128
+	y[N2] = 1 // impulse, flat spectrum
+	const l = N / 8
+	for _, p := range []float64{float64(l) / N, -float64(l) / N} {
+		z := fft(y, 1)
+		truncateSpectrum(&z, p)
+		for n := 1; n < N; n++ {
+			if z[n] != cmplx.Conj(z[N-n]) {
+				t.Fatalf(`truncateSpectrum(%g) bin %d => not conjugate of bin %d`, p, n, N-n)
+			}
+		}
+		for n := 0; n <= N2; n++ {
+			if high := n >= l; (z[n] != 0) == (high == (p > 0)) {
+				t.Errorf(`truncateSpectrum(%g) bin %d => %v`, p, n, z[n])
+				break
+			}
+		}
+		for n, v := range fft(z, -1) {
+			if math.Abs(imag(v)) > 1e-9 {
+				t.Fatalf(`truncateSpectrum(%g) => ifft sample %d has imaginary part %g`, p, n, imag(v))
+			}
+		}
+	}
+}
+
+func TestOverlap(t *testing.T) {
+	defer func() { overlap = 2 }()
+	rms := map[int]float64{}
+	for _, o := range []int{2, 4} {
+		overlap = o
+		eng := New(SampleRate)
+		if err := eng.Launch("in 330hz osc sine mul 0.25 fft ifft out dac"); err != nil {
+			t.Fatal(err)
+		}
+		buf := eng.Render(4 * N)
+		eng.Close()
+		sum := 0.0
+		for _, s := range buf[6*N:] { // after first frames
+			sum += s * s
+		}
+		rms[o] = math.Sqrt(sum / float64(2*N))
+	}
+	if rms[2] == 0 || math.Abs(rms[4]/rms[2]-1) > 0.1 {
+		t.Errorf(`fft, ifft rms level => %.3g at overlap 4, expected %.3g as at overlap 2`, rms[4], rms[2])
+	}
+}
+
+type failingWriter struct{ closed bool }
+
+func (f *failingWriter) Write(b []byte) (int, error) { return 0, os.ErrClosed }
+func (f *failingWriter) Close() error                { f.closed = yes; return nil }
+
+func TestReconnector(t *testing.T) {
+	f := &failingWriter{}
+	r := &reconnector{
+		sc:      soundcard{file: f, sampleRate: 48000, format: 16, channels: "stereo"},
+		device:  "/nonexistent/dsp",
+		attempt: time.Now(),
+	}
+	b := make([]byte, 4*480) // 10ms of frames
+	start := time.Now()
+	if n, rr := r.Write(b); n != len(b) || rr != nil {
+		t.Errorf("Write on lost soundcard => %d, %v, expected %d, <nil>", n, rr, len(b))
+	}
+	if !r.lost || !f.closed {
+		t.Errorf("lost soundcard not closed")
+	}
+	if d := time.Since(start); d < 10*time.Millisecond {
+		t.Errorf("discarded output took %v, expected at least 10ms", d)
+	}
+}
+
+func TestOperatorDocs(t *testing.T) {
+	for name, o := range operators {
+		if o.doc == "" {
+			t.Errorf("operator %s has no doc for `: help`", name)
+		}
+	}
+}
+
+func TestOversizedInput(t *testing.T) {
+	eng := New(SampleRate)
+	defer eng.Close()
+	done := make(chan error)
+	go func() {
+		done <- eng.Launch(strings.Repeat("in 1 ", cap(tokens)) + "out dac")
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error(`Launch(oversized) => nil, expected error`)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal(`Launch(oversized) blocked`)
+	}
+	if err := eng.Launch("in " + strings.Repeat("x", maxTokenLength+1) + " out dac"); err == nil {
+		t.Error(`Launch(long token) => nil, expected error`)
+	}
+	if err := eng.Launch("in 330hz osc sine out dac"); err != nil {
+		t.Errorf(`Launch() after oversized input => %v, expected nil`, err)
+	}
+}
+
+func TestValidName(t *testing.T) {
+	for name, expected := range map[string]bool{
+		"kick":  yes,
+		"a.0":   yes,
+		"b2":    yes,
+		"^freq": yes,
+		"@1":    yes,
+		"Snare": yes,
+		"ünï":   yes,
+		"":      not,
+		"3kick": not,
+		".a":    not,
+		"kick-": not,
+		"a+b":   not,
+		"v-1":   not,
+	} {
+		if v := validName(name); v != expected {
+			t.Errorf("validName(%q) => %v, expected %v", name, v, expected)
+		}
+	}
+}
+
+func TestStretch(t *testing.T) {
+	const sr = 48000.0
+	w := make([]float64, sr) // 1s of 440Hz
+	for i := range w {
+		w[i] = math.Sin(Tau * 440 * float64(i) / sr)
+	}
+	for _, ratio := range []float64{0.5, 2, 4} { // duration is multiplied by ratio
+		var g granulator
+		p, crossings := 0.0, 0
+		prev := 0.0
+		for i := 0; i < sr; i++ {
+			y := g.stretch(w, p, 1/(grainLength*sr))
+			p += 1 / (sr * ratio)
+			if i > sr/10 && prev < 0 && y >= 0 { // after first grains
+				crossings++
+			}
+			prev = y
+		}
+		if f := float64(crossings) / 0.9; math.Abs(f-440) > 440*0.05 {
+			t.Errorf("stretch by %g => %.1fHz, expected 440Hz", ratio, f)
+		}
+		g = granulator{ratio: ratio} // as sratio, input 0
+		for i := 0; i < sr/2; i++ {
+			g.stretch(w, 0, 1/(grainLength*sr))
+		}
+		if p := wrap(0.5/ratio, 1); math.Abs(g.pos-p) > 1e-9 {
+			t.Errorf("sratio %g => position %.4f after 0.5s, expected %.4f", ratio, g.pos, p)
+		}
+	}
+}
+
+func TestSendsToListings(t *testing.T) {
+	for _, tst := range []struct {
+		l     listing
+		sends bool
+	}{
+		{listing{{Op: "in", Opd: "1"}, {Op: "out", Opd: "dac"}}, not},
+		{listing{{Op: "in", Opd: "1"}, {Op: "out", Opd: "a"}, {Op: "out", Opd: "dac"}}, not},
+		{listing{{Op: "in", Opd: "1"}, {Op: ".out", Opd: "Lfo"}}, yes},
+		{listing{{Op: "in", Opd: "1"}, {Op: "out", Opd: "tempo"}, {Op: "out", Opd: "dac"}}, yes},
+		{listing{{Op: "in", Opd: "1"}, {Op: ".>sync"}}, yes},
+		{listing{{Op: "in", Opd: "1"}, {Op: "level", Opd: "0"}, {Op: "out", Opd: "dac"}}, yes},
+	} {
+		if s := sendsToListings(tst.l); s != tst.sends {
+			t.Errorf("sendsToListings(%v) => %v, expected %v", tst.l, s, tst.sends)
+		}
+	}
+}
+
+func TestRecursiveFunction(t *testing.T) {
+	var s systemState
+	s.fIn = true
+	s.newListing = listing{
+		operation{Op: "[", Opd: "blah"},
+		operation{Op: "in", Opd: "330hz"},
+		operation{Op: "blah", Opd: ""},
+		operation{Op: "]", Opd: ""},
+	}
+	s.hasOperand = make(map[string]bool)
+	s.funcs = map[string]fn{"other": {Body: listing{{Op: "blah"}}}}
+	if s, _ = endFunctionDefine(s); s.fIn {
+		t.Error(`endFunctionDefine(self-referential), expected function input to end`)
+	}
+	if _, ok := s.funcs["blah"]; ok {
+		t.Error(`endFunctionDefine(self-referential) => defined, expected rejection`)
+	}
+	s.fIn = true
+	s.newListing[2].Op = "other" // indirect, via other
+	if s, _ = endFunctionDefine(s); s.funcs["blah"].Body != nil {
+		t.Error(`endFunctionDefine(indirectly self-referential) => defined, expected rejection`)
+	}
+}
+
+func TestNestedFunction(t *testing.T) {
+	var s systemState
+	s.clr = func(m string, i ...interface{}) int { return 0 }
+	s.out = map[string]struct{}{}
+	s.funcs = map[string]fn{ // foo uses bar, whichever is defined first
+		"foo": {Body: listing{{Op: "bar", Opd: "@"}, {Op: "out", Opd: "b"}, {Op: "bar", Opd: "b"}}},
+		"bar": {Body: listing{{Op: "in", Opd: "@"}, {Op: "out", Opd: "a"}}},
+	}
+	s.operator, s.operands = "foo", []string{"330hz"}
+	s.dispListing = listing{{Op: "foo", Opd: "2"}, {Op: "bar", Opd: "3"}} // second instance of foo
+	f, ok := parseFunction(s)
+	if !ok {
+		t.Fatal(`parseFunction(foo) => not ok, expected expansion of bar`)
+	}
+	expected := []string{"in 330hz", "out a.foo.1_0", "out b.foo.1", "in b.foo.1", "out a.foo.1_2"}
+	if len(f) != len(expected) {
+		t.Fatalf(`parseFunction(foo) => %v, expected %v`, f, expected)
+	}
+	for i, o := range f {
+		if got := o.Op + " " + o.Opd; got != expected[i] {
+			t.Errorf(`parseFunction(foo)[%d] => %s, expected %s`, i, got, expected[i])
+		}
+	}
+	if !f[0].num {
+		t.Error(`parseFunction(foo) => argument of bar not parsed as a number`)
+	}
+	s.dispListing = append(listing{{Op: "bar", Opd: "4"}}, s.dispListing...) // inserted by an edit
+	if f, _ := parseFunction(s); f[1].Opd != "a.foo.1_0" {
+		t.Errorf(`parseFunction(foo) after another function inserted => %s, expected a.foo.1_0 unchanged`, f[1].Opd)
+	}
+}
+
+func TestEraseOperations(t *testing.T) {
+	var s systemState
+	s.hasOperand = map[string]bool{"in": true, "osc": false, "lpf": true}
+	s.dispListing = listing{{Op: "in", Opd: "330hz"}, {Op: "osc"}, {Op: "lpf", Opd: "100hz"}}
+	for _, c := range []struct {
+		operand  string
+		expected []string
+	}{
+		{"2", []string{"in", "330hz", ""}},
+		{"lpf", []string{"in", "330hz", "osc", "", "lpf"}}, // erase last, continue with lpf
+	} {
+		s.operand = c.operand
+		emptyTokens()
+		eraseOperations(s)
+		got := []string{}
+		for len(tokens) > 0 {
+			got = append(got, (<-tokens).tk)
+		}
+		if strings.Join(got, " ") != strings.Join(c.expected, " ") {
+			t.Errorf(`eraseOperations(%s) => %q, expected %q`, c.operand, got, c.expected)
+		}
+	}
+}
+
+func TestUndoOperation(t *testing.T) {
+	var s systemState
+	s.out = map[string]struct{}{"a.0": {}}
+	s.dispListing = listing{{Op: "in", Opd: "330hz"}, {Op: "osc"}, {Op: "fn", Opd: "2"}}
+	s.newListing = listing{{Op: "in", Opd: "330hz"}, {Op: "osc"}, {Op: "mul", Opd: "2"}, {Op: "out", Opd: "a.0"}}
+	s.marks = []int{0, 1, 2} // fn expanded to two operations
+	undoOperation(&s)
+	if len(s.dispListing) != 2 || len(s.newListing) != 2 {
+		t.Errorf(`undoOperation() => %d, %d operations, expected 2, 2`, len(s.dispListing), len(s.newListing))
+	}
+	if _, in := s.out["a.0"]; in {
+		t.Error(`undoOperation() => out of function remains, expected removal`)
+	}
+	s.do = 3
+	if undoOperation(&s); len(s.dispListing) != 2 {
+		t.Error(`undoOperation() with do pending => operation removed, expected only do cancelled`)
+	}
+}
+
+func TestValidControl(t *testing.T) {
+	for _, c := range []struct {
+		v        float64
+		expected bool
+	}{
+		{1.5, true},
+		{0, false},
+		{-1, false},
+		{math.Inf(1), false},
+		{math.NaN(), false},
+	} {
+		if got := validControl(&c.v); got != c.expected {
+			t.Errorf(`validControl(%v) => %v, expected %v`, c.v, got, c.expected)
+		}
+	}
+	if !validControl(nil) {
+		t.Error(`validControl(nil) => false, expected unset value to be valid`)
+	}
+}
+
+func TestWavMorph(t *testing.T) {
+	wavs := [][]float64{{0, 1, 0, -1}, {1, 1, 1, 1}, {0, 0.5, 1, 0.5}}
+	for _, r := range []float64{0, 0.1, 0.25, 0.6, 0.99} {
+		for x := range wavs {
+			if got, expected := wavMorph(wavs, float64(x), r), wavSample(wavs[x], r); got != expected {
+				t.Errorf(`wavMorph(%d, %v) => %v, expected %v as for single wav`, x, r, got, expected)
+			}
+		}
+		expected := (wavSample(wavs[0], r) + wavSample(wavs[1], r)) / 2
+		if got := wavMorph(wavs, 0.5, r); math.Abs(got-expected) > 1e-12 {
+			t.Errorf(`wavMorph(0.5, %v) => %v, expected %v`, r, got, expected)
+		}
+		if got, expected := wavMorph(wavs, 7, r), wavSample(wavs[2], r); got != expected {
+			t.Errorf(`wavMorph(7, %v) => %v, expected last wav %v`, r, got, expected)
+		}
+	}
+}
+
+func TestNoiseColours(t *testing.T) {
+	no := noise(88172645463325252)
+	var p pinkNoise
+	var y float64
+	coeff := lpf_coeff(brownCorner, 48000)
+	n := 48000 * 10
+	var pink, brown, mean float64
+	for i := 0; i < n; i++ {
+		w := no.ise()
+		pink += math.Pow(p.filter(w), 2)
+		b := brownNoise(&y, w, coeff)
+		brown += b * b
+		mean += b
+	}
+	for _, c := range []struct {
+		name string
+		rms  float64
+	}{{"pink", math.Sqrt(pink / float64(n))}, {"brown", math.Sqrt(brown / float64(n))}} {
+		if c.rms < 0.4 || c.rms > 0.8 { // white is 0.577
+			t.Errorf(`%s noise rms => %.3g, expected close to white`, c.name, c.rms)
+		}
+	}
+	if mean /= float64(n); math.Abs(mean) > 0.05 {
+		t.Errorf(`brown noise mean => %.3g, expected no drift`, mean)
+	}
+}
+
+func TestRequestSigs(t *testing.T) {
+	eng := New(SampleRate)
+	defer eng.Close()
+	if err := eng.Launch("in 330hz osc sine mul 0.5 out dac"); err != nil {
+		t.Fatal(err)
+	}
+	stopRender, rendered := make(chan struct{}), make(chan struct{})
+	go func() { // keep the sound engine running
+		defer close(rendered)
+		for {
+			select {
+			case <-stopRender:
+				return
+			default:
+				eng.Render(480)
+			}
+		}
+	}()
+	defer func() { close(stopRender); <-rendered }()
+	sigs, ok := requestSigs(0, nil)
+	if !ok {
+		t.Fatal(`requestSigs(0) => not ok, expected signals of listing`)
+	}
+	sigs[lenReserved] = 0.123 // an exported signal, otherwise unused
+	if _, ok := requestSigs(0, sigs); !ok {
+		t.Fatal(`requestSigs(0, sigs) => not ok, expected write`)
+	}
+	if got, _ := requestSigs(0, nil); got[lenReserved] != 0.123 {
+		t.Errorf(`requestSigs(0) after write => %v, expected 0.123`, got[lenReserved])
+	}
+	if _, ok := requestSigs(3, nil); ok {
+		t.Error(`requestSigs(3) => ok, expected no such listing`)
+	}
+}
+
+func TestPlusAccumulates(t *testing.T) {
+	eng := New(SampleRate)
+	defer eng.Close()
+	if err := eng.Launch("in 0.25, out a, in 0.125, + a, out sum, in 0.125, in a, out rep, mul 0, out dac"); err != nil {
+		t.Fatal(err)
+	}
+	sg := eng.t.signals // of the listing just launched
+	eng.Render(480)
+	go eng.Render(480) // sound engine replies between samples
+	sigs, _ := requestSigs(0, nil)
+	if sum, rep := sigs[sg["sum"]], sigs[sg["rep"]]; sum != 0.375 || rep != 0.25 {
+		t.Errorf(`+ a => %v, in a => %v, expected 0.375 (accumulated) and 0.25 (replaced)`, sum, rep)
+	}
+}
+
+func TestQuantise(t *testing.T) {
+	defer func() { quantum = 0 }()
+	eng := New(SampleRate)
+	defer eng.Close()
+	if err := eng.Launch("in 480bpm, out tempo, in 0, out dac"); err != nil {
+		t.Fatal(err)
+	}
+	eng.Render(1000) // part way through the first beat
+	quantum = 1
+	// n counts samples processed once launched
+	if err := eng.Launch("in n, + 1, out n, mul 0, out dac"); err != nil {
+		t.Fatal(err)
+	}
+	eng.Render(int(SampleRate) / 4) // two beats at 480bpm
+	sg := eng.t.signals
+	go eng.Render(480) // sound engine replies between samples
+	sigs, _ := requestSigs(1, nil)
+	n, beat, tempo := sigs[sg["n"]], sigs[13], sigs[3]
+	if tempo <= 0 || n < 1 {
+		t.Fatalf(`quantised launch => %v samples processed at tempo %v, expected processing`, n, tempo)
+	}
+	if start := beat - (n-1)*tempo; start < 1-1e-9 || start > 1+tempo+1e-9 { // first sample at or after the boundary
+		t.Errorf(`quantised launch => started at beat %.6f, expected within a sample of beat 1`, start)
+	}
+}
+
+func TestStaged(t *testing.T) {
+	defer func() { display.Paused, staged = not, not }()
+	eng := New(SampleRate)
+	defer eng.Close()
+	display.Paused, staged = yes, yes // as --paused
+	done := make(chan error)
+	go func() {
+		for _, l := range []string{"in 330hz osc sine mul 0.3 out dac", "in 440hz osc sine mul 0.3 out dac"} {
+			if err := eng.Launch(l); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal(`Launch while staged => blocked, expected listings accepted while paused`)
+	}
+	if len(mutes) != 2 {
+		t.Errorf(`staged => %d listings, expected 2`, len(mutes))
+	}
+	<-pause // as `: play`
+	display.Paused = not
+	if p := peakOf(eng.Render(int(SampleRate) / 5)); p < 0.1 {
+		t.Errorf(`play after staging => peak %.3g, expected both listings`, p)
+	}
+}
+
+func TestRecordSample(t *testing.T) {
+	for _, cf := range []float64{math.MaxInt8, math.MaxInt16, math.MaxInt32} {
+		mid := 0.5 + 1/cf // dithered by 1 at the output bit depth
+		L, R := recordSample(mid, 0.25, 1, cf)
+		if math.Abs(L-(0.75*math.MaxInt16+1)) > 1e-6 || math.Abs(R-(0.25*math.MaxInt16+1)) > 1e-6 {
+			t.Errorf(`recordSample at %g => %.2f %.2f, expected 16bit with dither of 1`, cf, L, R)
+		}
+	}
+}
+
+func TestListingNoise(t *testing.T) {
+	if listingNoise(3) != listingNoise(3) {
+		t.Error(`listingNoise(3) => differs, expected the same seed each time`)
+	}
+	for i := 0; i < 4; i++ {
+		a, b := listingNoise(i), listingNoise(i+1)
+		var ab, aa, bb float64
+		for n := 0; n < 100000; n++ {
+			x, y := a.ise(), b.ise()
+			ab += x * y
+			aa += x * x
+			bb += y * y
+		}
+		if c := ab / math.Sqrt(aa*bb); math.Abs(c) > 0.01 {
+			t.Errorf(`correlation of listings %d and %d => %.3g, expected < 0.01`, i, i+1, c)
+		}
+	}
+}
+
+func TestBuffs(t *testing.T) {
+	l := listing{{Op: "in"}, {Op: "buff"}, {Op: "tap"}, {Op: "buff"}}
+	if b := buffLoops(l, 10); len(b) != 2 || len(b[1]) != 10 {
+		t.Errorf(`buffLoops(2 buffs) => %d, expected 2 of length 10`, len(b))
+	}
+	if b := buffLoops(l[2:3], 10); len(b) != 1 {
+		t.Errorf(`buffLoops(tap) => %d, expected 1`, len(b))
+	}
+	var s systemState
+	for i := 0; i < maxBuffs; i++ {
+		s.newListing = append(s.newListing, operation{Op: "buff"})
+	}
+	if _, r := buffLimit(s); r != startNewOperation {
+		t.Errorf(`buffLimit(%d buffs) => %s, expected startNewOperation`, maxBuffs, results[r])
+	}
+	eng := New(SampleRate)
+	defer eng.Close()
+	if err := eng.Launch("in 2hz, osc, lt 0.01, mul 0.5, buff 100ms, tap 50ms, buff 30ms, tap 20ms, buff 1s, out dac"); err != nil {
+		t.Fatal(err)
+	}
+	if p := peakOf(eng.Render(int(SampleRate) / 2)); p == 0 {
+		t.Error(`three buffs => silence, expected echoes`)
+	}
+}
+
+func TestSelfTargeting(t *testing.T) {
+	eng := New(SampleRate)
+	defer eng.Close()
+	if err := eng.Launch("in 0, out dac"); err != nil {
+		t.Fatal(err)
+	}
+	// -Inf to level, then NaN to pan and depth, of the listing itself
+	if err := eng.Launch("in 0, log, level 1, mul 0, pan 1, depth 1, in 220hz, osc, sine, out dac"); err != nil {
+		t.Fatal(err)
+	}
+	buf := eng.Render(int(SampleRate) / 10)
+	for i, s := range buf {
+		if s != s || math.IsInf(s, 0) {
+			t.Fatalf(`sample %d => %v, expected non-finite level, pan and depth to be ignored`, i, s)
+		}
+	}
+	if peakOf(buf) < 0.1 || !started {
+		t.Errorf(`peak => %.3g, expected the sine at unchanged level`, peakOf(buf))
+	}
+}
+
+func TestCompact(t *testing.T) {
+	defer func(m muteSlice, lv []float64, b, dm []bool) {
+		mutes, levels, bypassed, display.Mute = m, lv, b, dm
+	}(mutes, levels, bypassed, display.Mute)
+	mutes, levels = muteSlice{0, 1, 1}, []float64{1, 0.5, 1}
+	bypassed, display.Mute = []bool{not, not, not}, []bool{yes, not, not}
+	sigs := func() []float64 {
+		s := make([]float64, lenReserved+1)
+		s[lenReserved] = 1
+		return s
+	}
+	d := []listingStack{
+		{sigs: sigs()}, // deleted
+		{sigs: sigs(), listing: []opSE{{N: lenReserved, Opn: 3, Opd: "1"}}},
+		{sigs: sigs(), listing: []opSE{{N: lenReserved, Opn: 29, Opd: "1"}, {N: lenReserved, Opn: 3, Opd: "1"}}},
+	}
+	d = compact(d, []int{-1, 0, 1})
+	if len(d) != 2 || len(mutes) != 2 || levels[0] != 0.5 || display.Mute[0] {
+		t.Fatalf(`compact => %d listings, mutes %v, levels %v, expected 2, [1 1], [0.5 1]`, len(d), mutes, levels)
+	}
+	if l := d[1].listing; d[1].sigs[l[0].N] != 0 || d[1].sigs[l[1].N] != 1 {
+		t.Errorf(`compact => from %v, shared literal %v, expected 0 and 1`, d[1].sigs[l[0].N], d[1].sigs[l[1].N])
+	}
+	if d[0].sigs[d[0].listing[0].N] != 1 {
+		t.Errorf(`compact => literal of listing without references changed`)
+	}
+
+	opn := map[string]int{"from": 29, "mul": 3}
+	l := listing{{Op: "from", Opd: "2"}, {Op: "mul", Opd: "2"}}
+	if r, c := renumber(l, opn, []int{0, -1, 1}); c != 1 || r[0].Opd != "1" || r[1].Opd != "2" || l[0].Opd != "2" {
+		t.Errorf(`renumber => %v, %d, expected [from 1, mul 2], 1`, r, c)
+	}
+	if _, c := renumber(l, opn, []int{0, 1, -1}); c != -1 {
+		t.Errorf(`renumber of reference to removed listing => %d, expected -1`, c)
+	}
+}
+
+func TestRecoverFunctions(t *testing.T) {
+	j, rr := json.MarshalIndent(map[string]interface{}{
+		"Version": saveVersion,
+		"aaa":     fn{Comment: "first", Body: listing{{Op: "in", Opd: "@"}}},
+		"bbb":     fn{Comment: "second", Body: listing{{Op: "mul", Opd: "2"}}},
+		"ccc":     fn{Comment: "third", Body: listing{{Op: "osc", Opd: "@"}}},
+	}, "", "\t")
+	if rr != nil {
+		t.Fatal(rr)
+	}
+	truncated := j[:bytes.Index(j, []byte("third"))]
+	if json.Unmarshal(truncated, &map[string]json.RawMessage{}) == nil {
+		t.Fatal("truncated functions file parsed without error")
+	}
+	raw := recoverFunctions(truncated)
+	if len(raw) != 3 {
+		t.Fatalf(`recoverFunctions => %d entries, expected Version, aaa and bbb`, len(raw))
+	}
+	var f fn
+	if rr := json.Unmarshal(raw["bbb"], &f); rr != nil || f.Body[0].Op != "mul" {
+		t.Errorf(`recovered "bbb" => %v, %v, expected mul 2`, f, rr)
+	}
+	if raw := recoverFunctions([]byte("[]")); len(raw) != 0 {
+		t.Errorf(`recoverFunctions of array => %d entries, expected none`, len(raw))
+	}
+}
+
+func TestSaveAtomic(t *testing.T) {
+	dir := t.TempDir()
+	f := dir + "/info.json"
+	for _, s := range []string{"first\n", "second\n"} {
+		if !save([]byte(s), f) {
+			t.Fatalf(`save(%q) => false`, s)
+		}
+	}
+	if b, rr := os.ReadFile(f); rr != nil || string(b) != "second\n" {
+		t.Errorf(`read after save => %q, %v, expected "second\n"`, b, rr)
+	}
+	if fs, _ := os.ReadDir(dir); len(fs) != 1 {
+		t.Errorf(`save left %d files, expected no temporary files`, len(fs)-1)
+	}
+	if st, rr := os.Stat(f); rr != nil {
+		t.Error(rr)
+	} else if st.Mode().Perm() != 0644 {
+		t.Errorf(`save => mode %v, expected -rw-r--r--`, st.Mode())
+	}
+}
+
+func TestWorkIn(t *testing.T) {
+	wd, rr := os.Getwd()
+	if rr != nil {
+		t.Fatal(rr)
+	}
+	defer os.Chdir(wd)
+	dir := t.TempDir() + "/instance"
+	if !workIn(dir) {
+		t.Fatalf(`workIn(%s) => false`, dir)
+	}
+	if !save([]byte("{}\n"), "infodisplay.json") {
+		t.Fatal(`save after workIn => false`)
+	}
+	for _, f := range []string{"infodisplay.json", tempDir, "recordings"} {
+		if _, rr := os.Stat(dir + "/" + f); rr != nil {
+			t.Errorf(`workIn => %v`, rr)
+		}
+	}
+}
+
+func TestOssDevice(t *testing.T) {
+	for _, a := range []string{"99", "dsp99", "/dev/dsp99"} {
+		if d := ossDevice(a); d != defaultDevice {
+			t.Errorf(`ossDevice(%s) => %s, expected fall back to %s`, a, d, defaultDevice)
+		}
+	}
+	for _, a := range []string{"null", "/dev/null"} { // stands in for a soundcard
+		if d := ossDevice(a); d != "/dev/null" {
+			t.Errorf(`ossDevice(%s) => %s, expected /dev/null`, a, d)
+		}
+	}
+}
+
+func TestParseSampleRate(t *testing.T) {
+	for a, want := range map[string]uint32{
+		"44.1": 44100, "44": 44100, "48": 48000, "88.2": 88200, "96": 96000, "192": 192000,
+		"22.05": 22050, "44100": 44100, "96000": 96000,
+	} {
+		if r, ok := parseSampleRate(a); !ok || r != want {
+			t.Errorf(`parseSampleRate(%s) => %d, %v, expected %d`, a, r, ok, want)
+		}
+	}
+	for _, a := range []string{"", "fast", "8", "384", "200000", "-48", "48000.5"} {
+		if r, ok := parseSampleRate(a); ok {
+			t.Errorf(`parseSampleRate(%s) => %d, expected not accepted`, a, r)
+		}
+	}
+}
+
+func TestPruneRecordings(t *testing.T) {
+	dir := t.TempDir() + "/"
+	now := time.Now()
+	for i, f := range []string{"listing.a.json", "listing.b.json", "listing.c.json", "other.json"} {
+		if rr := os.WriteFile(dir+f, []byte("[]\n"), 0644); rr != nil {
+			t.Fatal(rr)
+		}
+		mod := now.Add(time.Duration(-i) * time.Hour) // a is most recent
+		os.Chtimes(dir+f, mod, mod)
+	}
+	if n := pruneRecordings(dir, 5); n != 0 {
+		t.Errorf(`pruneRecordings under cap => %d removed, expected none`, n)
+	}
+	if n := pruneRecordings(dir, 1); n != 2 {
+		t.Errorf(`pruneRecordings(1) => %d removed, expected 2`, n)
+	}
+	fs, _ := os.ReadDir(dir)
+	got := ""
+	for _, f := range fs {
+		got += f.Name() + " "
+	}
+	if got != "listing.a.json other.json " {
+		t.Errorf(`pruneRecordings(1) left %s, expected the most recent and other files`, got)
+	}
+}
+
+func TestLogEvent(t *testing.T) {
+	logEvent("clip") // not logging, no file
+	f, rr := os.Create(t.TempDir() + "/info.log")
+	if rr != nil {
+		t.Fatal(rr)
+	}
+	defer func(l *os.File) { log = l }(log)
+	log = f
+	logEvent("listing %d limited", 3)
+	f.Close()
+	b, _ := os.ReadFile(f.Name())
+	if !strings.HasSuffix(string(b), " listing 3 limited\n") || len(b) != len("15:04:05.000 listing 3 limited\n") {
+		t.Errorf(`logEvent => %q, expected timestamp and "listing 3 limited"`, b)
+	}
+}
+
+func TestAutoGain(t *testing.T) {
+	autoGain = yes
+	defer func() { autoGain = not }()
+	eng := New(SampleRate)
+	defer eng.Close()
+	if err := eng.Launch("in 330hz osc sine mul 0.05 out dac"); err != nil {
+		t.Fatal(err)
+	}
+	early := peakOf(eng.Render(int(SampleRate))[int(SampleRate):])
+	eng.Render(8 * int(SampleRate))
+	late := peakOf(eng.Render(int(SampleRate)))
+	if late < 2*early || late > 1 {
+		t.Errorf(`autogain => peak %.3g after 1s, %.3g after 10s, expected a quiet tone to be raised`, early, late)
+	}
+	if display.AutoGain < 6 || display.AutoGain > 12 {
+		t.Errorf(`display.AutoGain => %.3gdB, expected between 6 and 12dB`, display.AutoGain)
+	}
+}
+
+func TestGainReduction(t *testing.T) {
+	eng := New(SampleRate)
+	defer eng.Close()
+	if err := eng.Launch("in 330hz osc sine mul 0.1 out dac"); err != nil {
+		t.Fatal(err)
+	}
+	eng.Render(int(SampleRate))
+	quiet := display.GRdb
+	if err := eng.Launch("in 2000hz osc sine mul 0.8 out dac"); err != nil {
+		t.Fatal(err)
+	}
+	eng.Render(int(SampleRate))
+	if quiet > 0.1 || display.GRdb < 1 || display.GRdb > 24 {
+		t.Errorf(`display.GRdb => %.3gdB then %.3gdB, expected none then reduction in dB`, quiet, display.GRdb)
+	}
+}
+
+func peakOf(buf []float64) float64 {
+	peak := 0.0
+	for _, s := range buf {
+		peak = math.Max(peak, math.Abs(s))
+	}
+	return peak
+}
+
+func TestPrefs(t *testing.T) {
+	wd, rr := os.Getwd()
+	if rr != nil {
+		t.Fatal(rr)
+	}
+	defer os.Chdir(wd)
+	os.Chdir(t.TempDir())
+	defer func(g, b float64, mc bool) { mouse.gain, mouse.base, mouse.mc = g, b, mc }(mouse.gain, mouse.base, mouse.mc)
+	mouse.gain, mouse.base, mouse.mc = 0.5, 2, not
+	savePrefs()
+	mouse.gain, mouse.base, mouse.mc = 1, 10, yes
+	loadPrefs()
+	if mouse.gain != 0.5 || mouse.base != 2 || mouse.mc {
+		t.Errorf(`loadPrefs() => %v %v %v, expected 0.5 2 false`, mouse.gain, mouse.base, mouse.mc)
+	}
+	defer func(a, w float64) { limAttack, stereoWidth = a, w }(limAttack, stereoWidth)
+	limAttack, stereoWidth = 1/(5e-3*SampleRate), 0.5 // 5ms
+	savePrefs()
+	limAttack, stereoWidth = 1, 1
+	loadPrefs()
+	if a := 1 / (limAttack * SampleRate); math.Abs(a-5e-3) > 1e-9 || stereoWidth != 0.5 {
+		t.Errorf(`loadPrefs() limiter attack, width => %.3gs %v, expected 5ms 0.5`, a, stereoWidth)
+	}
+	os.WriteFile(prefsFile, []byte(`{"MouseGain": 0, "MouseBase": 0.5}`), 0644)
+	loadPrefs()
+	if mouse.gain != 0.5 || mouse.base != 2 {
+		t.Errorf(`loadPrefs(out of range) => %v %v, expected unchanged`, mouse.gain, mouse.base)
+	}
+}
+
+func TestDecodeEmptyWavs(t *testing.T) {
+	wd, rr := os.Getwd()
+	if rr != nil {
+		t.Fatal(rr)
+	}
+	defer os.Chdir(wd)
+	os.Chdir(t.TempDir())
+	os.Mkdir("wavs", 0755)
+	os.WriteFile("wavs/empty.wav", nil, 0644)
+	os.WriteFile("wavs/header.wav", monoWavHeader(0), 0644)
+	os.WriteFile("wavs/half.wav", append(monoWavHeader(1), 0), 0644) // half a sample
+	os.WriteFile("wavs/trunc.wav", monoWavHeader(0)[:30], 0644)      // header cut short
+	os.WriteFile("wavs/good.wav", append(monoWavHeader(4), 0, 64, 0, 192), 0644)
+	defer func(m func(string, ...interface{})) { msg = m }(msg)
+	var msgs []string
+	msg = func(s string, i ...interface{}) {
+		msgs = append(msgs, sf(s, i...))
+	}
+	w := decodeWavs()
+	if len(w) != 1 || w[0].Name != "good" || len(w[0].Data) != 2 {
+		t.Fatalf(`decodeWavs() => %v, expected good.wav only`, w)
+	}
+	skipped := 0
+	for _, m := range msgs {
+		if strings.Contains(m, "skipped") || strings.Contains(m, "error") {
+			skipped++
+		}
+	}
+	if skipped < 4 {
+		t.Errorf(`decodeWavs() => %q, expected 4 files reported as skipped`, msgs)
+	}
+	if wavMorph(nil, 0, 0.5) != 0 || wavSample(nil, 0.5) != 0 {
+		t.Error(`wavMorph(nil) => expected 0 without wavs`)
+	}
+}
+
+// monoWavHeader is of 16bit mono 48kHz PCM
+func monoWavHeader(dataLen int) []byte {
+	h := make([]byte, 44)
+	copy(h, "RIFF")
+	copy(h[8:], "WAVEfmt ")
+	binary.LittleEndian.PutUint16(h[20:], 1)
+	binary.LittleEndian.PutUint16(h[22:], 1)
+	binary.LittleEndian.PutUint32(h[24:], 48000)
+	binary.LittleEndian.PutUint16(h[34:], 16)
+	copy(h[36:], "data")
+	binary.LittleEndian.PutUint32(h[40:], uint32(dataLen))
+	return h
+}
+
+func TestWavDir(t *testing.T) {
+	defer func(d string) { wavDir = d }(wavDir)
+	dir := t.TempDir()
+	os.WriteFile(dir+"/kick.wav", append(monoWavHeader(2), 0, 64), 0644)
+	wavDir = dir
+	if w := decodeWavs(); len(w) != 1 || w[0].Name != "kick" {
+		t.Errorf(`decodeWavs() from %s => %v, expected kick`, dir, w)
+	}
+	wavDir = dir + "/missing"
+	if w := decodeWavs(); w != nil {
+		t.Errorf(`decodeWavs() from missing directory => %v, expected none`, w)
+	}
+}
+
+func TestRewav(t *testing.T) {
+	defer func(d string) { wavDir = d }(wavDir)
+	wavDir = t.TempDir()
+	os.WriteFile(wavDir+"/kick.wav", append(monoWavHeader(2), 0, 64), 0644)
+	os.WriteFile(wavDir+"/snare.wav", append(monoWavHeader(4), 0, 64, 0, 32), 0644)
+	s := systemState{wmap: map[string]bool{"snare": yes}, wavSlice: wavs{{"snare", []float64{0.25}}}}
+	s, _ = rewav(s)
+	if len(s.wavSlice) != 2 || s.wavSlice[0].Name != "snare" || len(s.wavSlice[0].Data) != 1 || s.wavSlice[1].Name != "kick" {
+		t.Fatalf(`rewav() => %v, expected snare unchanged at 0 and kick added`, s.wavSlice)
+	}
+	if w := <-wavBank; len(w) != 2 || w[0][0] != 0.25 {
+		t.Errorf(`rewav() => %v sent to sound engine, expected both wavs in order`, w)
+	}
+	rewav(s)
+	select {
+	case w := <-wavBank:
+		t.Errorf(`rewav() without new wavs => %v sent, expected nothing`, w)
+	default:
+	}
+}
+
+func TestRamp(t *testing.T) {
+	y, prev, up, down := 0.0, 0.0, 0.0, 0.0
+	steps := 0
+	for ; y < 1; steps++ { // press
+		y = ramp(y, 1, 0.3)
+		up += trig(&prev, y, yes)
+	}
+	if steps != 4 || up != 1 {
+		t.Errorf(`ramp to 1 => %d steps, %v rising edges, expected 4, 1`, steps, up)
+	}
+	for i := 0; i < 4; i++ { // release
+		y = ramp(y, 0, 0.3)
+		down += trig(&prev, y, not)
+	}
+	if y != 0 || down != 1 {
+		t.Errorf(`ramp to 0 => %v, %v falling edges, expected 0, 1`, y, down)
+	}
+}
+
+func TestStress(t *testing.T) {
+	eng := New(SampleRate)
+	defer eng.Close()
+	if err := eng.Launch("in 330hz osc sine mul 0.5 out dac"); err != nil {
+		t.Fatal(err)
+	}
+	stopRender, rendered := make(chan struct{}), make(chan struct{})
+	go func() { // keep the sound engine running
+		defer close(rendered)
+		for {
+			select {
+			case <-stopRender:
+				return
+			default:
+				eng.Render(480)
+			}
+		}
+	}()
+	defer func() { close(stopRender); <-rendered }()
+	tokens <- token{"3", -1, yes}                // argument, as read by modeArg
+	s, _ := stressTest(initialiseListing(eng.t)) // as at the start of a new listing
+	if len(s.dispListings) != 1 || len(s.verbose) != 1 || len(mutes) != 1 || len(levels) != 1 {
+		t.Errorf(`stressTest(3) => %d listings, %d mutes remaining, expected 1`, len(s.dispListings), len(mutes))
+	}
+	if sigs, ok := requestSigs(1, nil); ok || sigs != nil {
+		t.Error(`stressTest(3) => listing 1 remains in sound engine, expected removal`)
+	}
+}
+
+func TestClipThreshold(t *testing.T) {
+	defer func() { clipThr = 1 }()
+	gr := map[float64]float64{}
+	for _, ct := range []float64{1, 4} {
+		clipThr = ct
+		eng := New(SampleRate)
+		if err := eng.Launch("in 330hz osc sine mul 2 out dac"); err != nil {
+			t.Fatal(err)
+		}
+		eng.Render(int(SampleRate))
+		gr[ct] = display.GRdb
+		eng.Close()
+	}
+	if gr[4]-gr[1] < 4 { // listing at 6dB
+		t.Errorf(`display.GRdb => %.3gdB at ct 1, %.3gdB at ct 4, expected about 6dB more reduction at the output`, gr[1], gr[4])
+	}
+}
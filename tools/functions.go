@@ -47,7 +47,15 @@ func main() {
 	file := "functions.json"
 
 	Json, err := os.ReadFile(file)
-	err2 := json.Unmarshal(Json, &functions)
+	var raw map[string]json.RawMessage
+	err2 := json.Unmarshal(Json, &raw)
+	delete(raw, "Version") // format version of functions.json, not a function
+	if err2 == nil {
+		Json, err2 = json.Marshal(raw)
+	}
+	if err2 == nil {
+		err2 = json.Unmarshal(Json, &functions)
+	}
 	if err != nil || err2 != nil {
 		fmt.Printf("error loading %s: %v %v\n", file, err, err2)
 		fmt.Println("please try running from main (containing) directory")
@@ -79,7 +87,7 @@ func main() {
 	}
 	if len(os.Args) > 1 && os.Args[1] == "--docs" {
 		// process comments for docs
-		type mm struct{ at, at1, at2 bool }
+		type mm struct{ at, at1, at2, at3 bool }
 		for _, name := range functions.sortedByName() {
 			function := functions[name]
 			M := mm{}
@@ -97,18 +105,22 @@ func main() {
 					M.at1 = true
 				case "@2":
 					M.at2 = true
+				case "@3":
+					M.at3 = true
 				}
 			}
 			args := 0
 			switch M {
-			case mm{false, false, false}:
+			case mm{false, false, false, false}:
 				// nop
-			case mm{true, false, false}:
+			case mm{true, false, false, false}:
 				args = 1
-			case mm{true, true, false}:
+			case mm{true, true, false, false}:
 				args = 2
-			case mm{true, true, true}:
+			case mm{true, true, true, false}:
 				args = 3
+			case mm{true, true, true, true}:
+				args = 4
 			default:
 				fmt.Printf("malformed function: %s\n", name) // probably not needed
 				return
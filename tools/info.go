@@ -1,13 +1,16 @@
 // info.go displays information about a running instance of Syntə
-// Press enter to quit
+// Type eg. `pitch 1.5` or `tempo 0.5` to set these in Syntə, press enter to quit
 
 package main
 
 import (
+	"bufio"
 	"encoding/json"
 	"fmt"
 	"math"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -28,25 +31,33 @@ const (
 func main() {
 
 	type Disp struct { // TODO import this from a types package
-		On      bool
-		Mode    string // func add fon/foff
-		Vu      float64
-		Clip    bool
-		Load    time.Duration
-		Info    string
-		MouseX  float64
-		MouseY  float64
-		Paused  bool
-		Mute    []bool
-		SR      float64
-		GR      bool
-		Sync    bool
-		v       bool
-		Format  int
-		Channel string
+		On       bool
+		Mode     string // func add fon/foff
+		Vu       float64
+		Clip     bool
+		Load     time.Duration
+		Info     string
+		MouseX   float64
+		MouseY   float64
+		Paused   bool
+		Mute     []bool
+		SR       float64
+		GR       bool
+		GRdb     float64
+		Sync     bool
+		Beat     int
+		Verbose  bool
+		Format   int
+		Channel  string
+		Backend  string
+		Device   string
+		Bypass   bool
+		Clipl    int
+		AutoGain float64
 	}
 	var display = Disp{
-		SR: 48000,
+		SR:    48000,
+		Clipl: -1,
 	}
 
 	type message struct {
@@ -75,11 +86,15 @@ func main() {
 		dB := "     "
 		for {
 			Json, err := os.ReadFile(file)
-			json.Unmarshal(Json, &display)
-			//if err != nil || err2 != nil {
-			if err != nil { // ignore unmarshal errors
+			next := Disp{Clipl: -1}
+			switch {
+			case err != nil:
 				messages[9].Content = fmt.Sprintf("error loading %s: %v\n", file, err)
 				//messages[10].Content = "info display out of order"
+			case len(Json) == 0 || json.Unmarshal(Json, &next) != nil || next.SR <= 0:
+				// caught mid-write, keep the last good state
+			default:
+				display = next
 			}
 
 			if display.Paused {
@@ -101,11 +116,14 @@ func main() {
 			if display.Sync {
 				sync = fmt.Sprintf("%s●%s", yellow, reset)
 			}
+			beat := ""
+			if display.Beat > 0 {
+				beat = fmt.Sprintf("%s%d%s", italic, display.Beat, reset)
+			}
 
+			mode := "\t" // display is kept between loops, so not overwritten
 			if display.Mode == "on" {
-				display.Mode = italic + "funcsave: " + reset + display.Mode
-			} else {
-				display.Mode = "\t"
+				mode = italic + "funcsave: " + reset + display.Mode
 			}
 
 			loadColour := ""
@@ -147,11 +165,20 @@ func main() {
 			}
 			gr := ""
 			if GRhold > 0 {
-				gr = yellow + "GR" + reset
+				gr = fmt.Sprintf("%sGR %4.1f %s%s", yellow, -display.GRdb, grMeter(display.GRdb), reset)
 				GRhold--
 			}
+			if display.Bypass {
+				gr = red + "BYP" + reset
+			}
+			if display.Clipl > -1 { // listing limited by its threshold, see `ct`
+				gr += fmt.Sprintf(" %sct %d%s", yellow, display.Clipl, reset)
+			}
+			if math.Abs(display.AutoGain) > 0.05 { // applied by `: autogain`
+				gr += fmt.Sprintf(" %sag %+.1f%s", cyan, display.AutoGain, reset)
+			}
 			db := math.Log10(display.Vu)
-			if math.IsInf(db, -1) {
+			if math.IsInf(db, 0) || math.IsNaN(db) {
 				db = -6
 			}
 			if n%10 == 0 {
@@ -172,14 +199,14 @@ func main() {
 				VU += "|"
 			}
 
-			soundcard := fmt.Sprintf("%dbit %2gkhz %s", display.Format, display.SR/1000, display.Channel)
+			soundcard := fmt.Sprintf("%s %dbit %2gkhz %s", display.Backend, display.Format, display.SR/1000, display.Channel)
 			if display.Format == 0 {
 				soundcard = "\t\t"
 			}
 
 			fmt.Printf("\033[H\033[2J")
 			fmt.Printf("%sSyntə info%s %spress enter to quit%s", cyan, reset, italic, reset)
-			fmt.Printf(`   %s   %s  %3s
+			fmt.Printf(`   %s %s  %s  %3s
 ╭───────────────────────────────────────────────────╮
    %sLoad:%s %v      %s     %s
 %s
@@ -194,10 +221,10 @@ func main() {
 %s
 %s
 %s
-      %sMouse-X:%s %5.4g       %sMouse-Y:%s %5.4g
+      %sMouse-X:%s %5.4g       %sMouse-Y:%s %5.4g   %s%s%s
 ╰───────────────────────────────────────────────────╯`,
-				sync, paused, timer,
-				yellow, reset, L, display.Mode, soundcard,
+				sync, beat, paused, timer,
+				yellow, reset, L, mode, soundcard,
 				messages[0].Content,
 				messages[1].Content,
 				messages[2].Content,
@@ -212,6 +239,7 @@ func main() {
 				VU,
 				blue, reset, display.MouseX,
 				blue, reset, display.MouseY,
+				italic, display.Device, reset,
 			)
 
 			time.Sleep(20 * time.Millisecond)
@@ -221,10 +249,47 @@ func main() {
 			}
 		}
 	}()
+	in := bufio.NewScanner(os.Stdin)
+	for !exit && in.Scan() {
+		f := strings.Fields(in.Text())
+		if len(f) == 0 {
+			break
+		}
+		remote(f)
+	}
 	if !exit {
-		fmt.Scanln()
 		exit = true
 		<-stop
 	}
 	fmt.Printf("info display closed.\n")
 }
+
+// remote writes pitch or tempo to control.json, which Syntə reads and removes.
+// Written to a temporary file first so Syntə never reads a partial write
+func remote(f []string) {
+	key := map[string]string{"pitch": "Pitch", "tempo": "Tempo"}
+	if len(f) != 2 || key[f[0]] == "" {
+		return
+	}
+	v, err := strconv.ParseFloat(f[1], 64)
+	if err != nil || v <= 0 {
+		return
+	}
+	c := map[string]float64{key[f[0]]: v}
+	b, err := json.Marshal(c)
+	if err != nil {
+		return
+	}
+	if os.WriteFile("control.json.tmp", b, 0666) != nil {
+		return
+	}
+	os.Rename("control.json.tmp", "control.json")
+}
+
+// grMeter returns a bar of one segment per dB of gain reduction, up to 12
+func grMeter(db float64) string {
+	if math.IsNaN(db) || db < 0.5 {
+		return ""
+	}
+	return strings.Repeat("▪", int(math.Min(12, math.Round(db))))
+}
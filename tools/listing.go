@@ -9,7 +9,9 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"os"
+	"strings"
 	"time"
 )
 
@@ -40,7 +42,9 @@ func main() {
 	var exit bool
 	stop := make(chan struct{})
 	var mute []bool
+	var level []float64
 	var verbose bool
+	var exported []string
 
 	go func() {
 		for {
@@ -65,13 +69,21 @@ func main() {
 				//fmt.Printf("error decoding %s: %v %v\n", file2, err, err2)
 				//time.Sleep(2 * time.Second)
 			}
+			err2 = json.Unmarshal(d["Level"], &level)
+			if err2 != nil {
+				level = nil // older Syntə, or not yet published
+			}
+			err2 = json.Unmarshal(d["Exports"], &exported)
+			if err2 != nil {
+				exported = nil // older Syntə
+			}
 			err2 = json.Unmarshal(d["Verbose"], &verbose)
 			if err2 != nil {
 				//fmt.Printf("error decoding %s: %v %v\n", file2, err, err2)
 				//time.Sleep(2 * time.Second)
 			}
 			fmt.Printf("\033[H\033[2J")
-			fmt.Printf("%sSyntə listings%s %spress enter to quit%s", cyan, reset, italic, reset)
+			fmt.Printf("%sSyntə listings%s %spress enter to quit%s  %sexported%s", cyan, reset, italic, reset, blue, reset)
 			//fmt.Println()
 
 			for i, list := range listing {
@@ -81,7 +93,7 @@ func main() {
 				if list[0].Op == "deleted" {
 					continue
 				}
-				fmt.Printf("\n%d:\t", i)
+				fmt.Printf("\n%d: %s\t", i, meter(level, i))
 				m, c, y := magenta, cyan, yellow
 				if len(mute) >= i+1 { // bounds check
 					if mute[i] {
@@ -99,13 +111,17 @@ func main() {
 					}
 					fmt.Printf("%s%s%s", mm, v.Op, reset)
 					if opd := v.Opd; opd != "" {
-						fmt.Printf(" %s%s%s", c, opd, reset)
+						cc := c
+						if isExported(opd, exported) && cc != italic {
+							cc = blue // shared with other listings
+						}
+						fmt.Printf(" %s%s%s", cc, opd, reset)
 					}
 					if i == len(list)-1 || verbose {
 						continue
 					}
 					switch list[i+1].Op {
-					case "in", "pop", ")", "index", "from", "ifft", "/b":
+					case "in", "pop", ")", "index", "from", "from~", "ifft", "/b":
 						//fmt.Printf(" %s|%s  ", y, reset)
 						fmt.Printf("\n\t")
 					default:
@@ -129,3 +145,27 @@ func main() {
 	}
 	fmt.Printf("display listing closed.\n")
 }
+
+func isExported(opd string, exported []string) bool {
+	for _, e := range exported {
+		if opd == e {
+			return true
+		}
+	}
+	return false
+}
+
+// meter draws a level bar of 5 segments, 12dB each, from -60dB
+func meter(level []float64, i int) string {
+	n := 0
+	if i < len(level) && level[i] > 0 {
+		n = int((20*math.Log10(level[i]) + 60) / 12)
+	}
+	if n < 0 {
+		n = 0
+	}
+	if n > 5 {
+		n = 5
+	}
+	return fmt.Sprintf("%s%-5s%s", green, strings.Repeat("|", n), reset)
+}
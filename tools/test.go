@@ -1,11 +1,12 @@
 // produce test listings from README.md
+// examples are the fenced code blocks tagged `syt`, these are also checked by TestReadmeExamples
 
-// usage (from project root): `go run test.go > test.syt`
+// usage (from project root): `go run tools/test.go > test.syt`
 
 package main
 
 import (
-	"encoding/xml"
+	"bufio"
 	"fmt"
 	"os"
 	"strings"
@@ -13,24 +14,26 @@ import (
 
 func main() {
 	file := "README.md"
-	type Result struct {
-		Test []string
-	}
-	tests := Result{}
-	// open README.md
-	f, err := os.ReadFile(file)
+	f, err := os.Open(file)
 	if err != nil {
 		fmt.Println(err)
+		return
 	}
-	// decode
-	err = xml.Unmarshal(f, &tests)
-	if err != nil {
-		fmt.Printf("error: %v", err)
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	in := false
+	for s.Scan() {
+		switch l := strings.TrimSpace(s.Text()); {
+		case !in && l == "```syt":
+			in = true
+		case in && l == "```":
+			in = false
+		case in:
+			fmt.Println(strings.ReplaceAll(l, "[name of wav file]", "local"))
+		}
 	}
-
-	for _, t := range tests.Test {
-		s := strings.ReplaceAll(t, "[name of wav file]", "local")
-		fmt.Printf("%v", s)
+	if err := s.Err(); err != nil {
+		fmt.Printf("error: %v", err)
 	}
 	fmt.Println("solo 0")
 }